@@ -0,0 +1,111 @@
+package main
+
+/*
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"unsafe"
+)
+
+var decode = struct {
+	max_array int
+}{
+	max_array: 1 << 16,
+}
+
+// arena tracks the C memory of a request, all of it is freed
+// at once when the request is done.
+
+type arena struct {
+	ptrs []unsafe.Pointer
+}
+
+func (a *arena) CString(s string) (*C.char, error) {
+	if strings.IndexByte(s, 0) >= 0 {
+		return nil, errors.New("NUL byte in string")
+	}
+
+	ret := C.CString(s)
+	a.ptrs = append(a.ptrs, unsafe.Pointer(ret))
+
+	return ret, nil
+}
+
+func (a *arena) Calloc(count int, size uintptr) (unsafe.Pointer, error) {
+	if count < 0 || count > decode.max_array+1 {
+		return nil, errors.New("Array too long")
+	}
+
+	if count == 0 {
+		count = 1
+	}
+
+	ret := C.calloc(C.size_t(count), C.size_t(size))
+
+	if ret == nil {
+		return nil, errors.New("Out of memory")
+	}
+
+	a.ptrs = append(a.ptrs, ret)
+
+	return ret, nil
+}
+
+func (a *arena) Free() {
+	for _, p := range a.ptrs {
+		C.free(p)
+	}
+	a.ptrs = nil
+}
+
+// decode_object decodes a JSON object like json.Unmarshal
+// but rejects the keys given more than once.
+
+func decode_object(data []byte) (map[string]*json.RawMessage, error) {
+	ret := make(map[string]*json.RawMessage)
+	dec := json.NewDecoder(bytes.NewReader(data))
+
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, errors.New("Not an object")
+	}
+
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key := tok.(string)
+		if _, ok := ret[key]; ok {
+			return nil, &duplicate_error{key}
+		}
+		var value *json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, err
+		}
+		ret[key] = value
+	}
+
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+
+	if _, err := dec.Token(); err == nil {
+		return nil, errors.New("Data after the object")
+	}
+
+	return ret, nil
+}
+
+type duplicate_error struct {
+	key string
+}
+
+func (e *duplicate_error) Error() string {
+	return "Duplicate key " + e.key
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"unsafe"
+)
+
+// stub_type looks like a Slurm structure: a string, counted and
+// terminated arrays, a time, a nested structure and plain values.
+
+var stub_type = reflect.StructOf([]reflect.StructField{
+	{Name: "Name", Type: reflect.PtrTo(char_type)},
+	{Name: "Nodes", Type: reflect.TypeOf((*uint32)(nil))},
+	{Name: "Nodes_cnt", Type: reflect.TypeOf(uint32(0))},
+	{Name: "node_inx", PkgPath: "main", Type: reflect.TypeOf((*int32)(nil))},
+	{Name: "Names", Type: reflect.PtrTo(reflect.PtrTo(char_type))},
+	{Name: "Names_cnt", Type: reflect.TypeOf(uint16(0))},
+	{Name: "start_time", PkgPath: "main", Type: time_type},
+	{Name: "Ratio", Type: reflect.TypeOf(float64(0))},
+	{Name: "Flag", Type: reflect.TypeOf(false)},
+	{Name: "Sub", Type: reflect.StructOf([]reflect.StructField{
+		{Name: "Value", Type: reflect.TypeOf(int16(0))},
+	})},
+})
+
+func c_string(p unsafe.Pointer) string {
+	var b []byte
+	for ; *(*byte)(p) != 0; p = unsafe.Pointer(uintptr(p) + 1) {
+		b = append(b, *(*byte)(p))
+	}
+	return string(b)
+}
+
+func FuzzDecode(f *testing.F) {
+	for _, s := range []string{
+		`{"Name":"test","Nodes":[1,2,3],"NodeInx":[4,5],"Names":["a","b"]}`,
+		`{"StartTime":"2020-01-01T00:00:00","Ratio":0.5,"Flag":true,"Sub":{"Value":-1}}`,
+		`{"Nodes":["infinite",null],"StartTime":null,"Names":[]}`,
+		`{"Nodes":[1],"Nodes":[2]}`,
+		`{"Nodes_cnt":100,"Nodes":[1]}`,
+		`{"Name":"a\u0000b"}`,
+		`{"Sub":{"Value":70000}}`,
+		`[1,2]`,
+		`{"Name":"a"} {}`,
+	} {
+		f.Add([]byte(s))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		req, err := decode_object(data)
+
+		if err != nil {
+			return
+		}
+
+		for key, value := range req {
+			if value != nil && !json.Valid(*value) {
+				t.Fatalf("%s: invalid value %s", key, *value)
+			}
+		}
+
+		val := reflect.New(stub_type)
+		obj := make(object_map)
+		obj.Add(val.Interface())
+
+		for _, key := range []string{"NodesCnt", "NamesCnt"} {
+			if _, ok := obj[key]; ok {
+				t.Fatalf("%s is a key", key)
+			}
+		}
+
+		mem := &arena{}
+		defer mem.Free()
+
+		for key, value := range req {
+			dst, ok := obj[key]
+			if !ok {
+				continue
+			}
+			if dst.Set(value, mem) != nil {
+				return
+			}
+		}
+
+		s := val.Elem()
+
+		if v := req["Nodes"]; v != nil {
+			var array []json.RawMessage
+			json.Unmarshal(*v, &array)
+
+			if n := s.FieldByName("Nodes_cnt").Uint(); n != uint64(len(array)) {
+				t.Fatalf("Nodes_cnt is %d for %d nodes", n, len(array))
+			}
+
+			nodes := (*[1 << 16]uint32)(unsafe.Pointer(s.FieldByName("Nodes").Pointer()))
+
+			for k, e := range array {
+				var n uint32
+				if string(e) != "null" && json.Unmarshal(e, &n) == nil && nodes[k] != n {
+					t.Fatalf("Nodes[%d] is %d, not %d", k, nodes[k], n)
+				}
+			}
+		}
+
+		if v := req["NodeInx"]; v != nil {
+			var array []json.RawMessage
+			json.Unmarshal(*v, &array)
+
+			values := (*[1 << 16]int32)(unsafe.Pointer(s.FieldByName("node_inx").Pointer()))
+
+			if values[len(array)] != -1 {
+				t.Fatalf("NodeInx is not terminated")
+			}
+		}
+
+		if v := req["Names"]; v != nil {
+			var array []string
+			json.Unmarshal(*v, &array)
+
+			if n := s.FieldByName("Names_cnt").Uint(); n != uint64(len(array)) {
+				t.Fatalf("Names_cnt is %d for %d names", n, len(array))
+			}
+
+			names := (*[1 << 16]unsafe.Pointer)(unsafe.Pointer(s.FieldByName("Names").Pointer()))
+
+			for k, name := range array {
+				if c := c_string(names[k]); c != name {
+					t.Fatalf("Names[%d] is %q, not %q", k, c, name)
+				}
+			}
+		}
+
+		if v := req["Name"]; v != nil && string(*v) != "null" {
+			var name string
+			json.Unmarshal(*v, &name)
+
+			if c := c_string(unsafe.Pointer(s.FieldByName("Name").Pointer())); c != name {
+				t.Fatalf("Name is %q, not %q", c, name)
+			}
+		}
+	})
+}
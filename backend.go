@@ -0,0 +1,341 @@
+package main
+
+/*
+#include <stdlib.h>
+
+#include "slurm/slurm.h"
+#include "slurm/slurm_errno.h"
+*/
+import "C"
+
+import "unsafe"
+
+// slurm_backend is the part of libslurm used by the handlers,
+// the calls return the slurm errno, 0 on success, and the loaded
+// messages must be released with Free.
+
+type slurm_backend interface {
+	SubmitBatchJob(req *C.job_desc_msg_t) (*C.submit_response_msg_t, C.int)
+	AllocateResources(req *C.job_desc_msg_t) (*C.resource_allocation_response_msg_t, C.int)
+	AllocationLookup(job_id C.uint32_t) (*C.resource_allocation_response_msg_t, C.int)
+	JobWillRun(req *C.job_desc_msg_t) (*C.will_run_response_msg_t, C.int)
+	UpdateJob(req *C.job_desc_msg_t) C.int
+	NotifyJob(job_id C.uint32_t, message *C.char) C.int
+	LoadJobs(update_time C.time_t, show_flags C.uint16_t) (*C.job_info_msg_t, C.int)
+	LoadJob(job_id C.uint32_t, show_flags C.uint16_t) (*C.job_info_msg_t, C.int)
+	GetJobSteps(update_time C.time_t, job_id, step_id C.uint32_t, show_flags C.uint16_t) (*C.job_step_info_response_msg_t, C.int)
+
+	SignalJob(job_id C.uint32_t, signal C.uint16_t) C.int
+	SignalJobStep(job_id, step_id, signal C.uint32_t) C.int
+	KillJob(job_id C.uint32_t, signal, flags C.uint16_t) C.int
+	KillJobStep(job_id, step_id C.uint32_t, signal C.uint16_t) C.int
+	CompleteJob(job_id, return_code C.uint32_t) C.int
+	TerminateJobStep(job_id, step_id C.uint32_t) C.int
+	Suspend(job_id C.uint32_t) C.int
+	Resume(job_id C.uint32_t) C.int
+	Requeue(job_id, state C.uint32_t) C.int
+
+	LoadNode(update_time C.time_t, show_flags C.uint16_t) (*C.node_info_msg_t, C.int)
+	LoadNodeSingle(name *C.char, show_flags C.uint16_t) (*C.node_info_msg_t, C.int)
+	UpdateNode(req *C.update_node_msg_t) C.int
+	LoadFrontEnd(update_time C.time_t) (*C.front_end_info_msg_t, C.int)
+	UpdateFrontEnd(req *C.update_front_end_msg_t) C.int
+	LoadTopo() (*C.topo_info_response_msg_t, C.int)
+
+	LoadPartitions(update_time C.time_t, show_flags C.uint16_t) (*C.partition_info_msg_t, C.int)
+	CreatePartition(req *C.update_part_msg_t) C.int
+	UpdatePartition(req *C.update_part_msg_t) C.int
+	DeletePartition(req *C.delete_part_msg_t) C.int
+
+	LoadReservations(update_time C.time_t) (*C.reserve_info_msg_t, C.int)
+	CreateReservation(req *C.resv_desc_msg_t) (string, C.int)
+	UpdateReservation(req *C.resv_desc_msg_t) C.int
+	DeleteReservation(req *C.reservation_name_msg_t) C.int
+	LoadLicenses(update_time C.time_t, show_flags C.uint16_t) (*C.license_info_msg_t, C.int)
+
+	GetTriggers() (*C.trigger_info_msg_t, C.int)
+	SetTrigger(req *C.trigger_info_t) C.int
+	ClearTrigger(req *C.trigger_info_t) C.int
+
+	GetStatistics(req *C.stats_info_request_msg_t) (*C.stats_info_response_msg_t, C.int)
+	ResetStatistics(req *C.stats_info_request_msg_t) C.int
+	LoadCtlConf(update_time C.time_t) (*C.slurm_conf_t, C.int)
+	Ping(primary C.int) C.int
+	Reconfigure() C.int
+	Shutdown(options C.uint16_t) C.int
+	Takeover(backup_inx C.int) C.int
+
+	Free(msg interface{})
+}
+
+var backend slurm_backend = cgo_backend{}
+
+// cgo_backend talks to slurmctld through libslurm
+
+type cgo_backend struct{}
+
+func get_errno(ret C.int) C.int {
+	if ret != 0 {
+		return C.slurm_get_errno()
+	}
+	return 0
+}
+
+func (cgo_backend) SubmitBatchJob(req *C.job_desc_msg_t) (*C.submit_response_msg_t, C.int) {
+	var res *C.submit_response_msg_t
+	ret := C.slurm_submit_batch_job(req, &res)
+	return res, get_errno(ret)
+}
+
+func (cgo_backend) AllocateResources(req *C.job_desc_msg_t) (*C.resource_allocation_response_msg_t, C.int) {
+	var res *C.resource_allocation_response_msg_t
+	ret := C.slurm_allocate_resources(req, &res)
+	return res, get_errno(ret)
+}
+
+func (cgo_backend) AllocationLookup(job_id C.uint32_t) (*C.resource_allocation_response_msg_t, C.int) {
+	var res *C.resource_allocation_response_msg_t
+	ret := C.slurm_allocation_lookup(job_id, &res)
+	return res, get_errno(ret)
+}
+
+// JobWillRun returns no details when the controller only
+// knows if the job can run at all.
+
+func (cgo_backend) JobWillRun(req *C.job_desc_msg_t) (*C.will_run_response_msg_t, C.int) {
+	var res *C.will_run_response_msg_t
+
+	if ret := C.slurm_job_will_run2(req, &res); ret != 0 {
+		return nil, get_errno(ret)
+	}
+
+	if res == nil {
+		return nil, get_errno(C.slurm_job_will_run(req))
+	}
+
+	return res, 0
+}
+
+func (cgo_backend) UpdateJob(req *C.job_desc_msg_t) C.int {
+	return get_errno(C.slurm_update_job(req))
+}
+
+func (cgo_backend) NotifyJob(job_id C.uint32_t, message *C.char) C.int {
+	return get_errno(C.slurm_notify_job(job_id, message))
+}
+
+func (cgo_backend) LoadJobs(update_time C.time_t, show_flags C.uint16_t) (*C.job_info_msg_t, C.int) {
+	var res *C.job_info_msg_t
+	ret := C.slurm_load_jobs(update_time, &res, show_flags)
+	return res, get_errno(ret)
+}
+
+func (cgo_backend) LoadJob(job_id C.uint32_t, show_flags C.uint16_t) (*C.job_info_msg_t, C.int) {
+	var res *C.job_info_msg_t
+	ret := C.slurm_load_job(&res, job_id, show_flags)
+	return res, get_errno(ret)
+}
+
+func (cgo_backend) GetJobSteps(update_time C.time_t, job_id, step_id C.uint32_t, show_flags C.uint16_t) (*C.job_step_info_response_msg_t, C.int) {
+	var res *C.job_step_info_response_msg_t
+	ret := C.slurm_get_job_steps(update_time, job_id, step_id, &res, show_flags)
+	return res, get_errno(ret)
+}
+
+func (cgo_backend) SignalJob(job_id C.uint32_t, signal C.uint16_t) C.int {
+	return get_errno(C.slurm_signal_job(job_id, signal))
+}
+
+func (cgo_backend) SignalJobStep(job_id, step_id, signal C.uint32_t) C.int {
+	return get_errno(C.slurm_signal_job_step(job_id, step_id, signal))
+}
+
+func (cgo_backend) KillJob(job_id C.uint32_t, signal, flags C.uint16_t) C.int {
+	return get_errno(C.slurm_kill_job(job_id, signal, flags))
+}
+
+func (cgo_backend) KillJobStep(job_id, step_id C.uint32_t, signal C.uint16_t) C.int {
+	return get_errno(C.slurm_kill_job_step(job_id, step_id, signal))
+}
+
+func (cgo_backend) CompleteJob(job_id, return_code C.uint32_t) C.int {
+	return get_errno(C.slurm_complete_job(job_id, return_code))
+}
+
+func (cgo_backend) TerminateJobStep(job_id, step_id C.uint32_t) C.int {
+	return get_errno(C.slurm_terminate_job_step(job_id, step_id))
+}
+
+func (cgo_backend) Suspend(job_id C.uint32_t) C.int {
+	return get_errno(C.slurm_suspend(job_id))
+}
+
+func (cgo_backend) Resume(job_id C.uint32_t) C.int {
+	return get_errno(C.slurm_resume(job_id))
+}
+
+func (cgo_backend) Requeue(job_id, state C.uint32_t) C.int {
+	return get_errno(C.slurm_requeue(job_id, state))
+}
+
+func (cgo_backend) LoadNode(update_time C.time_t, show_flags C.uint16_t) (*C.node_info_msg_t, C.int) {
+	var res *C.node_info_msg_t
+	ret := C.slurm_load_node(update_time, &res, show_flags)
+	return res, get_errno(ret)
+}
+
+func (cgo_backend) LoadNodeSingle(name *C.char, show_flags C.uint16_t) (*C.node_info_msg_t, C.int) {
+	var res *C.node_info_msg_t
+	ret := C.slurm_load_node_single(&res, name, show_flags)
+	return res, get_errno(ret)
+}
+
+func (cgo_backend) UpdateNode(req *C.update_node_msg_t) C.int {
+	return get_errno(C.slurm_update_node(req))
+}
+
+func (cgo_backend) LoadFrontEnd(update_time C.time_t) (*C.front_end_info_msg_t, C.int) {
+	var res *C.front_end_info_msg_t
+	ret := C.slurm_load_front_end(update_time, &res)
+	return res, get_errno(ret)
+}
+
+func (cgo_backend) UpdateFrontEnd(req *C.update_front_end_msg_t) C.int {
+	return get_errno(C.slurm_update_front_end(req))
+}
+
+func (cgo_backend) LoadTopo() (*C.topo_info_response_msg_t, C.int) {
+	var res *C.topo_info_response_msg_t
+	ret := C.slurm_load_topo(&res)
+	return res, get_errno(ret)
+}
+
+func (cgo_backend) LoadPartitions(update_time C.time_t, show_flags C.uint16_t) (*C.partition_info_msg_t, C.int) {
+	var res *C.partition_info_msg_t
+	ret := C.slurm_load_partitions(update_time, &res, show_flags)
+	return res, get_errno(ret)
+}
+
+func (cgo_backend) CreatePartition(req *C.update_part_msg_t) C.int {
+	return get_errno(C.slurm_create_partition(req))
+}
+
+func (cgo_backend) UpdatePartition(req *C.update_part_msg_t) C.int {
+	return get_errno(C.slurm_update_partition(req))
+}
+
+func (cgo_backend) DeletePartition(req *C.delete_part_msg_t) C.int {
+	return get_errno(C.slurm_delete_partition(req))
+}
+
+func (cgo_backend) LoadReservations(update_time C.time_t) (*C.reserve_info_msg_t, C.int) {
+	var res *C.reserve_info_msg_t
+	ret := C.slurm_load_reservations(update_time, &res)
+	return res, get_errno(ret)
+}
+
+func (cgo_backend) CreateReservation(req *C.resv_desc_msg_t) (string, C.int) {
+	name := C.slurm_create_reservation(req)
+
+	if name == nil {
+		return "", C.slurm_get_errno()
+	}
+
+	ret := C.GoString(name)
+	C.free(unsafe.Pointer(name))
+
+	return ret, 0
+}
+
+func (cgo_backend) UpdateReservation(req *C.resv_desc_msg_t) C.int {
+	return get_errno(C.slurm_update_reservation(req))
+}
+
+func (cgo_backend) DeleteReservation(req *C.reservation_name_msg_t) C.int {
+	return get_errno(C.slurm_delete_reservation(req))
+}
+
+func (cgo_backend) LoadLicenses(update_time C.time_t, show_flags C.uint16_t) (*C.license_info_msg_t, C.int) {
+	var res *C.license_info_msg_t
+	ret := C.slurm_load_licenses(update_time, &res, show_flags)
+	return res, get_errno(ret)
+}
+
+func (cgo_backend) GetTriggers() (*C.trigger_info_msg_t, C.int) {
+	var res *C.trigger_info_msg_t
+	ret := C.slurm_get_triggers(&res)
+	return res, get_errno(ret)
+}
+
+func (cgo_backend) SetTrigger(req *C.trigger_info_t) C.int {
+	return get_errno(C.slurm_set_trigger(req))
+}
+
+func (cgo_backend) ClearTrigger(req *C.trigger_info_t) C.int {
+	return get_errno(C.slurm_clear_trigger(req))
+}
+
+func (cgo_backend) GetStatistics(req *C.stats_info_request_msg_t) (*C.stats_info_response_msg_t, C.int) {
+	var res *C.stats_info_response_msg_t
+	ret := C.slurm_get_statistics(&res, req)
+	return res, get_errno(ret)
+}
+
+func (cgo_backend) ResetStatistics(req *C.stats_info_request_msg_t) C.int {
+	return get_errno(C.slurm_reset_statistics(req))
+}
+
+func (cgo_backend) LoadCtlConf(update_time C.time_t) (*C.slurm_conf_t, C.int) {
+	var res *C.slurm_conf_t
+	ret := C.slurm_load_ctl_conf(update_time, &res)
+	return res, get_errno(ret)
+}
+
+func (cgo_backend) Ping(primary C.int) C.int {
+	return get_errno(C.slurm_ping(primary))
+}
+
+func (cgo_backend) Reconfigure() C.int {
+	return get_errno(C.slurm_reconfigure())
+}
+
+func (cgo_backend) Shutdown(options C.uint16_t) C.int {
+	return get_errno(C.slurm_shutdown(options))
+}
+
+func (cgo_backend) Takeover(backup_inx C.int) C.int {
+	return get_errno(C.slurm_takeover(backup_inx))
+}
+
+func (cgo_backend) Free(msg interface{}) {
+	switch m := msg.(type) {
+	case *C.submit_response_msg_t:
+		C.slurm_free_submit_response_response_msg(m)
+	case *C.resource_allocation_response_msg_t:
+		C.slurm_free_resource_allocation_response_msg(m)
+	case *C.will_run_response_msg_t:
+		C.slurm_free_will_run_response_msg(m)
+	case *C.job_info_msg_t:
+		C.slurm_free_job_info_msg(m)
+	case *C.job_step_info_response_msg_t:
+		C.slurm_free_job_step_info_response_msg(m)
+	case *C.node_info_msg_t:
+		C.slurm_free_node_info_msg(m)
+	case *C.front_end_info_msg_t:
+		C.slurm_free_front_end_info_msg(m)
+	case *C.topo_info_response_msg_t:
+		C.slurm_free_topo_info_msg(m)
+	case *C.partition_info_msg_t:
+		C.slurm_free_partition_info_msg(m)
+	case *C.reserve_info_msg_t:
+		C.slurm_free_reservation_info_msg(m)
+	case *C.license_info_msg_t:
+		C.slurm_free_license_info_msg(m)
+	case *C.trigger_info_msg_t:
+		C.slurm_free_trigger_msg(m)
+	case *C.stats_info_response_msg_t:
+		C.slurm_free_stats_response_msg(m)
+	case *C.slurm_conf_t:
+		C.slurm_free_ctl_conf(m)
+	}
+}
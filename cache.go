@@ -0,0 +1,192 @@
+package main
+
+/*
+#include "slurm/slurm.h"
+#include "slurm/slurm_errno.h"
+*/
+import "C"
+
+import (
+	"hash/fnv"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// snapshot is a decoded slurm message, shared by all the readers of
+// the cache: it must never be modified once loaded.
+
+type snapshot struct {
+	last_update C.time_t
+	res         *table
+	array       []*table
+}
+
+type loader func(update_time C.time_t, show_flags C.uint16_t) (*snapshot, C.int)
+
+type cache_entry struct {
+	sync.Mutex
+	time time.Time
+	snap *snapshot
+}
+
+var cache = struct {
+	sync.Mutex
+	entries map[string]*cache_entry
+}{
+	entries: make(map[string]*cache_entry),
+}
+
+func get_cache_entry(key string) *cache_entry {
+	cache.Lock()
+	defer cache.Unlock()
+
+	entry, ok := cache.entries[key]
+
+	if !ok {
+		entry = &cache_entry{}
+		cache.entries[key] = entry
+	}
+
+	return entry
+}
+
+// cache_load returns the snapshot of name loaded by fn, refreshed with
+// its own last update time when older than the ttl. Concurrent misses
+// wait on the entry lock for a single call to slurmctld.
+
+func cache_load(name string, fn loader, update_time C.time_t, show_flags C.uint16_t) (*snapshot, C.int) {
+	ttl := get_config().cache_ttl
+
+	if ttl <= 0 {
+		return fn(update_time, show_flags)
+	}
+
+	entry := get_cache_entry(name + ":" + strconv.Itoa(int(show_flags)))
+
+	entry.Lock()
+	defer entry.Unlock()
+
+	if entry.snap == nil || time.Since(entry.time) >= ttl {
+		var last_update C.time_t
+
+		if entry.snap != nil {
+			last_update = entry.snap.last_update
+		}
+
+		snap, errno := fn(last_update, show_flags)
+
+		switch {
+		case errno == C.SLURM_NO_CHANGE_IN_DATA && entry.snap != nil:
+			entry.time = time.Now()
+		case errno != 0:
+			return nil, errno
+		default:
+			entry.snap = snap
+			entry.time = time.Now()
+		}
+	}
+
+	// same test as slurmctld
+
+	if update_time != 0 && entry.snap.last_update <= update_time-1 {
+		return nil, C.SLURM_NO_CHANGE_IN_DATA
+	}
+
+	return entry.snap, 0
+}
+
+// query_hash identifies the representation the query string asks for,
+// its fields, names, times and filters, so that the ETag of a query
+// doesn't match another one. The query is taken from the RequestURI,
+// r.URL has lost the parameters already used.
+
+func query_hash(r *http.Request) string {
+	var query url.Values
+
+	if u, err := url.ParseRequestURI(r.RequestURI); err == nil {
+		query = u.Query()
+	}
+
+	delete(query, "UpdateTime")
+
+	for _, values := range query {
+		sort.Strings(values)
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(query.Encode()))
+
+	return strconv.FormatUint(uint64(h.Sum32()), 16)
+}
+
+// conditional_time is the time of If-None-Match or If-Modified-Since,
+// the ETag being the LastUpdate it was made of and the query_hash.
+
+func conditional_time(r *http.Request) (int64, bool) {
+	hash := query_hash(r)
+
+	for _, etag := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		etag = strings.Trim(strings.TrimPrefix(strings.TrimSpace(etag), "W/"), `"`)
+		i := strings.IndexByte(etag, '-')
+		if i < 0 || etag[i+1:] != hash {
+			continue
+		}
+		if v, err := strconv.ParseInt(etag[:i], 10, 64); err == nil && v > 0 {
+			return v, true
+		}
+	}
+
+	if t, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil {
+		return t.Unix(), true
+	}
+
+	return 0, false
+}
+
+// if_modified sets update_time from If-None-Match or If-Modified-Since
+// when not given in the request, slurmctld then answers with no data
+// if nothing changed and the client gets a 304.
+
+func if_modified(r *http.Request, update_time *C.time_t) {
+	if *update_time != 0 {
+		return
+	}
+
+	if t, ok := conditional_time(r); ok {
+		*update_time = C.time_t(t + 1)
+	}
+}
+
+// load_error is errno_error for the loads of an update time, nothing
+// changed since it is not an error but a 304, whether the time came
+// from UpdateTime or from the validators of a conditional request.
+
+func load_error(w http.ResponseWriter, r *http.Request, errno C.int, update_time C.time_t) {
+	if errno != C.SLURM_NO_CHANGE_IN_DATA {
+		errno_error(w, r, errno)
+		return
+	}
+
+	set_validators(w, r, int64(update_time)-1)
+	w.WriteHeader(304)
+}
+
+func set_validators(w http.ResponseWriter, r *http.Request, last_update int64) {
+	if last_update <= 0 {
+		return
+	}
+
+	w.Header().Set("Last-Modified", time.Unix(last_update, 0).UTC().Format(http.TimeFormat))
+	w.Header().Set("ETag", `W/"`+strconv.FormatInt(last_update, 10)+"-"+query_hash(r)+`"`)
+}
+
+func set_last_modified(w http.ResponseWriter, r *http.Request, res *table) {
+	if last_update, ok := (*res)["LastUpdate"].(time_value); ok {
+		set_validators(w, r, int64(last_update))
+	}
+}
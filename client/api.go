@@ -0,0 +1,396 @@
+package client
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ListOptions selects and pages the records of LoadJobs and
+// LoadNodes, each filter keeps the records matching one of its values.
+
+type ListOptions struct {
+	Users      []string
+	States     []string
+	Partitions []string
+	Names      []string
+
+	// keys to sort by, prefixed by - to reverse
+	Sort   []string
+	Limit  int
+	Cursor int
+
+	ShowFlags []string
+}
+
+func (o *ListOptions) values(users bool) url.Values {
+	ret := url.Values{}
+
+	if o == nil {
+		return ret
+	}
+
+	set := func(key string, v []string) {
+		if len(v) > 0 {
+			ret.Set(key, strings.Join(v, ","))
+		}
+	}
+
+	if users {
+		set("user", o.Users)
+	}
+
+	set("state", o.States)
+	set("partition", o.Partitions)
+	set("name", o.Names)
+	set("sort", o.Sort)
+	set("ShowFlags", o.ShowFlags)
+
+	if o.Limit > 0 {
+		ret.Set("limit", strconv.Itoa(o.Limit))
+	}
+
+	if o.Cursor > 0 {
+		ret.Set("cursor", strconv.Itoa(o.Cursor))
+	}
+
+	return ret
+}
+
+func id(n uint32) string {
+	return strconv.FormatUint(uint64(n), 10)
+}
+
+type keys map[string]interface{}
+
+func (c *Client) SubmitBatchJob(ctx context.Context, desc *JobDesc) (*SubmitResponse, error) {
+	res := &SubmitResponse{}
+
+	if err := c.post(ctx, "/job/submit", desc, res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (c *Client) AllocateResources(ctx context.Context, desc *JobDesc) (*Allocation, error) {
+	res := &Allocation{}
+
+	if err := c.post(ctx, "/job/alloc", desc, res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (c *Client) AllocationLookup(ctx context.Context, job_id uint32) (*Allocation, error) {
+	res := &Allocation{}
+
+	if err := c.get(ctx, "/job/lookup", url.Values{"JobId": {id(job_id)}}, res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// JobWillRun returns nil when the job can run but the
+// controller gives no details.
+
+func (c *Client) JobWillRun(ctx context.Context, desc *JobDesc) (*WillRun, error) {
+	var res *WillRun
+
+	if err := c.post(ctx, "/job/willrun", desc, &res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (c *Client) UpdateJob(ctx context.Context, desc *JobDesc) error {
+	return c.post(ctx, "/job/update", desc, nil)
+}
+
+func (c *Client) NotifyJob(ctx context.Context, job_id uint32, message string) error {
+	return c.post(ctx, "/job/notify", keys{"JobId": job_id, "Message": message}, nil)
+}
+
+func (c *Client) LoadJobs(ctx context.Context, opt *ListOptions) (*JobList, error) {
+	res := &JobList{}
+
+	if err := c.get(ctx, "/jobs", opt.values(true), res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (c *Client) LoadJob(ctx context.Context, job_id uint32) (*Job, error) {
+	res := &JobList{}
+
+	if err := c.get(ctx, "/job/info", url.Values{"JobId": {id(job_id)}}, res); err != nil {
+		return nil, err
+	}
+
+	if len(res.Jobs) == 0 {
+		return nil, &Error{Status: 404, Message: "Invalid job id specified", Key: "JobId"}
+	}
+
+	return &res.Jobs[0], nil
+}
+
+// GetJobSteps loads the steps of a job, or of every job when job_id is 0.
+
+func (c *Client) GetJobSteps(ctx context.Context, job_id uint32) (*JobStepList, error) {
+	v := url.Values{}
+
+	if job_id != 0 {
+		v.Set("JobId", id(job_id))
+	}
+
+	res := &JobStepList{}
+
+	if err := c.get(ctx, "/job/steps", v, res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (c *Client) KillJob(ctx context.Context, job_id uint32, signal int) error {
+	return c.post(ctx, "/job/kill", keys{"JobId": job_id, "Signal": signal}, nil)
+}
+
+func (c *Client) SignalJob(ctx context.Context, job_id uint32, signal int) error {
+	return c.post(ctx, "/job/signal", keys{"JobId": job_id, "Signal": signal}, nil)
+}
+
+func (c *Client) CompleteJob(ctx context.Context, job_id uint32, return_code uint32) error {
+	return c.post(ctx, "/job/complete", keys{"JobId": job_id, "JobReturnCode": return_code}, nil)
+}
+
+func (c *Client) SuspendJob(ctx context.Context, job_id uint32) error {
+	return c.post(ctx, "/job/suspend", keys{"JobId": job_id}, nil)
+}
+
+func (c *Client) ResumeJob(ctx context.Context, job_id uint32) error {
+	return c.post(ctx, "/job/resume", keys{"JobId": job_id}, nil)
+}
+
+func (c *Client) RequeueJob(ctx context.Context, job_id uint32) error {
+	return c.post(ctx, "/job/requeue", keys{"JobId": job_id}, nil)
+}
+
+func (c *Client) KillJobStep(ctx context.Context, job_id, step_id uint32, signal int) error {
+	return c.post(ctx, "/job/step/kill", keys{"JobId": job_id, "StepId": step_id, "Signal": signal}, nil)
+}
+
+func (c *Client) SignalJobStep(ctx context.Context, job_id, step_id uint32, signal int) error {
+	return c.post(ctx, "/job/step/signal", keys{"JobId": job_id, "StepId": step_id, "Signal": signal}, nil)
+}
+
+func (c *Client) TerminateJobStep(ctx context.Context, job_id, step_id uint32) error {
+	return c.post(ctx, "/job/step/terminate", keys{"JobId": job_id, "StepId": step_id}, nil)
+}
+
+// WaitForJob loads the job every interval until it is finished.
+
+func (c *Client) WaitForJob(ctx context.Context, job_id uint32, interval time.Duration) (*Job, error) {
+	for {
+		job, err := c.LoadJob(ctx, job_id)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if job.Finished() {
+			return job, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return job, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+func (c *Client) LoadNodes(ctx context.Context, opt *ListOptions) (*NodeList, error) {
+	res := &NodeList{}
+
+	if err := c.get(ctx, "/nodes", opt.values(false), res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (c *Client) LoadNode(ctx context.Context, name string) (*Node, error) {
+	res := &Node{}
+
+	if err := c.get(ctx, "/nodes/"+url.PathEscape(name), nil, res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (c *Client) UpdateNode(ctx context.Context, desc *NodeUpdate) error {
+	return c.post(ctx, "/node/update", desc, nil)
+}
+
+func (c *Client) LoadFrontEnds(ctx context.Context) (*FrontEndList, error) {
+	res := &FrontEndList{}
+
+	if err := c.get(ctx, "/frontends", nil, res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (c *Client) UpdateFrontEnd(ctx context.Context, desc *FrontEndUpdate) error {
+	return c.post(ctx, "/frontend/update", desc, nil)
+}
+
+func (c *Client) LoadTopology(ctx context.Context) (*Topology, error) {
+	res := &Topology{}
+
+	if err := c.get(ctx, "/topologies", nil, res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (c *Client) LoadPartitions(ctx context.Context) (*PartitionList, error) {
+	res := &PartitionList{}
+
+	if err := c.get(ctx, "/partitions", nil, res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (c *Client) LoadPartition(ctx context.Context, name string) (*Partition, error) {
+	res := &Partition{}
+
+	if err := c.get(ctx, "/partitions/"+url.PathEscape(name), nil, res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (c *Client) CreatePartition(ctx context.Context, desc *PartitionDesc) error {
+	return c.post(ctx, "/partition/create", desc, nil)
+}
+
+func (c *Client) UpdatePartition(ctx context.Context, desc *PartitionDesc) error {
+	return c.post(ctx, "/partition/update", desc, nil)
+}
+
+func (c *Client) DeletePartition(ctx context.Context, name string) error {
+	return c.post(ctx, "/partition/delete", keys{"Name": name}, nil)
+}
+
+func (c *Client) LoadReservations(ctx context.Context) (*ReservationList, error) {
+	res := &ReservationList{}
+
+	if err := c.get(ctx, "/reservations", nil, res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// CreateReservation returns the name of the reservation,
+// chosen by slurm when desc has none.
+
+func (c *Client) CreateReservation(ctx context.Context, desc *ReservationDesc) (string, error) {
+	res := struct{ Name string }{}
+
+	if err := c.post(ctx, "/reservation/create", desc, &res); err != nil {
+		return "", err
+	}
+
+	return res.Name, nil
+}
+
+func (c *Client) UpdateReservation(ctx context.Context, desc *ReservationDesc) error {
+	return c.post(ctx, "/reservation/update", desc, nil)
+}
+
+func (c *Client) DeleteReservation(ctx context.Context, name string) error {
+	return c.post(ctx, "/reservation/delete", keys{"Name": name}, nil)
+}
+
+func (c *Client) LoadLicenses(ctx context.Context) (*LicenseList, error) {
+	res := &LicenseList{}
+
+	if err := c.get(ctx, "/licenses", nil, res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (c *Client) LoadTriggers(ctx context.Context) (*TriggerList, error) {
+	res := &TriggerList{}
+
+	if err := c.get(ctx, "/triggers", nil, res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (c *Client) SetTrigger(ctx context.Context, desc *TriggerDesc) error {
+	return c.post(ctx, "/trigger/create", desc, nil)
+}
+
+func (c *Client) ClearTrigger(ctx context.Context, desc *TriggerDesc) error {
+	return c.post(ctx, "/trigger/delete", desc, nil)
+}
+
+func (c *Client) LoadConf(ctx context.Context) (*Conf, error) {
+	res := &Conf{}
+
+	if err := c.get(ctx, "/conf", nil, res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (c *Client) Ping(ctx context.Context, primary int) error {
+	return c.get(ctx, "/ping", url.Values{"Primary": {strconv.Itoa(primary)}}, nil)
+}
+
+func (c *Client) GetStatistics(ctx context.Context) (*Statistics, error) {
+	res := &Statistics{}
+
+	if err := c.get(ctx, "/diag", nil, res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (c *Client) ResetStatistics(ctx context.Context) error {
+	return c.post(ctx, "/diag/reset", keys{}, nil)
+}
+
+func (c *Client) Reconfigure(ctx context.Context) error {
+	return c.post(ctx, "/reconfigure", keys{}, nil)
+}
+
+func (c *Client) Shutdown(ctx context.Context, options uint16) error {
+	return c.post(ctx, "/shutdown", keys{"Options": options}, nil)
+}
+
+func (c *Client) Takeover(ctx context.Context, backup_inx int) error {
+	return c.post(ctx, "/takeover", keys{"BackupInx": backup_inx}, nil)
+}
@@ -0,0 +1,266 @@
+// Package client calls a slurm-https server.
+//
+// Records keep the keys of the server, see /openapi.json, the main
+// ones are typed and all of them are kept raw in Keys.
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Client struct {
+	// URL of the server, like https://localhost:8443
+	URL  string
+	HTTP *http.Client
+
+	// the failed calls that change nothing are tried again
+	// Retries times, waiting Backoff then twice as long each time
+	Retries int
+	Backoff time.Duration
+}
+
+// TLSConfig loads the client certificate and the CA of the server,
+// like the -cert, -key and -ca flags of the server.
+
+func TLSConfig(cert, key, ca string) (*tls.Config, error) {
+	pair, err := tls.LoadX509KeyPair(cert, key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ca_cert, err := ioutil.ReadFile(ca)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ca_pool := x509.NewCertPool()
+
+	if !ca_pool.AppendCertsFromPEM(ca_cert) {
+		return nil, errors.New("no certificate found in " + ca)
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{pair},
+		RootCAs:      ca_pool,
+	}, nil
+}
+
+func New(url string, config *tls.Config) *Client {
+	return &Client{
+		URL: strings.TrimSuffix(url, "/"),
+		HTTP: &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: config,
+				Proxy:           http.ProxyFromEnvironment,
+			},
+			Timeout: 5 * time.Minute,
+		},
+		Retries: 3,
+		Backoff: 500 * time.Millisecond,
+	}
+}
+
+// Dial is New with the files of create-cert.sh, empty names
+// are client.crt, client.key and ca.crt.
+
+func Dial(url, cert, key, ca string) (*Client, error) {
+	if cert == "" {
+		cert = "client.crt"
+	}
+	if key == "" {
+		key = "client.key"
+	}
+	if ca == "" {
+		ca = "ca.crt"
+	}
+
+	config, err := TLSConfig(cert, key, ca)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return New(url, config), nil
+}
+
+// Error is an error sent by the server, Errno and Name are set
+// for the errors of slurm, Key for the errors of a key.
+
+type Error struct {
+	Status  int
+	Errno   int
+	Name    string
+	Message string
+	Key     string
+}
+
+func (e *Error) Error() string {
+	s := strconv.Itoa(e.Status)
+
+	if e.Name != "" {
+		s += " " + e.Name
+	}
+
+	s += ": " + e.Message
+
+	if e.Key != "" {
+		s += " (" + e.Key + ")"
+	}
+
+	return s
+}
+
+func get_error(err error) *Error {
+	var e *Error
+
+	if errors.As(err, &e) {
+		return e
+	}
+
+	return nil
+}
+
+// IsNotFound is true for the unknown jobs, nodes, partitions,
+// reservations and routes.
+
+func IsNotFound(err error) bool {
+	e := get_error(err)
+	return e != nil && e.Status == 404
+}
+
+// IsForbidden is true when the role of the client is too low.
+
+func IsForbidden(err error) bool {
+	e := get_error(err)
+	return e != nil && e.Status == 403
+}
+
+// IsUnavailable is true when slurmctld could not be reached.
+
+func IsUnavailable(err error) bool {
+	e := get_error(err)
+	return e != nil && e.Status == 503
+}
+
+// retryable is true for the errors of the connection
+// and when the server or slurmctld are unavailable.
+
+func retryable(err error) bool {
+	var conn *url.Error
+
+	if errors.As(err, &conn) {
+		return true
+	}
+
+	e := get_error(err)
+
+	if e == nil {
+		return false
+	}
+
+	switch e.Status {
+	case 429, 502, 503, 504:
+		return true
+	}
+
+	return false
+}
+
+// get calls a route with the keys in the query string, it is tried
+// again on errors as it changes nothing.
+
+func (c *Client) get(ctx context.Context, path string, keys url.Values, res interface{}) error {
+	if keys == nil {
+		keys = url.Values{}
+	}
+
+	keys.Set("names", "true")
+
+	wait := c.Backoff
+	var err error
+
+	for i := 0; ; i++ {
+		err = c.call(ctx, "GET", path+"?"+keys.Encode(), nil, res)
+
+		if err == nil || i >= c.Retries || !retryable(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+
+		wait *= 2
+	}
+}
+
+// post calls a route with the keys in a JSON body, only once.
+
+func (c *Client) post(ctx context.Context, path string, keys interface{}, res interface{}) error {
+	body, err := json.Marshal(keys)
+
+	if err != nil {
+		return err
+	}
+
+	return c.call(ctx, "POST", path+"?names=true", body, res)
+}
+
+func (c *Client) call(ctx context.Context, method, path string, body []byte, res interface{}) error {
+	req, err := http.NewRequest(method, c.URL+path, bytes.NewReader(body))
+
+	if err != nil {
+		return err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.HTTP.Do(req.WithContext(ctx))
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= 300 {
+		e := &Error{}
+		if json.Unmarshal(data, e) != nil {
+			e = &Error{Message: strings.TrimSpace(string(data))}
+		}
+		if e.Message == "" {
+			e.Message = http.StatusText(resp.StatusCode)
+		}
+		e.Status = resp.StatusCode
+		return e
+	}
+
+	if res == nil || len(bytes.TrimSpace(data)) == 0 {
+		return nil
+	}
+
+	return json.Unmarshal(data, res)
+}
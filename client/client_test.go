@@ -0,0 +1,147 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// serve starts a server answering with fn, and a client of it
+// that retries quickly
+
+func serve(t *testing.T, fn http.HandlerFunc) *Client {
+	srv := httptest.NewServer(fn)
+	t.Cleanup(srv.Close)
+
+	return &Client{
+		URL:     srv.URL,
+		HTTP:    srv.Client(),
+		Retries: 3,
+		Backoff: time.Millisecond,
+	}
+}
+
+func TestError(t *testing.T) {
+	c := serve(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/job/info":
+			w.WriteHeader(404)
+			fmt.Fprint(w, `{"Status":404,"Errno":2017,"Name":"ESLURM_INVALID_JOB_ID","Message":"Invalid job id specified"}`)
+		case "/job/update":
+			w.WriteHeader(400)
+			fmt.Fprint(w, `{"Status":400,"Message":"Unknown key","Key":"Foo"}`)
+		default:
+			w.WriteHeader(403)
+			fmt.Fprint(w, "forbidden\n")
+		}
+	})
+
+	ctx := context.Background()
+
+	_, err := c.LoadJob(ctx, 42)
+
+	var e *Error
+
+	if !errors.As(err, &e) || *e != (Error{404, 2017, "ESLURM_INVALID_JOB_ID", "Invalid job id specified", ""}) {
+		t.Errorf("LoadJob: %#v", err)
+	}
+
+	if !IsNotFound(err) || IsForbidden(err) {
+		t.Errorf("LoadJob: %v is not a 404", err)
+	}
+
+	err = c.UpdateJob(ctx, &JobDesc{JobId: Uint(42)})
+
+	if !errors.As(err, &e) || e.Status != 400 || e.Key != "Foo" || err.Error() != "400: Unknown key (Foo)" {
+		t.Errorf("UpdateJob: %#v", err)
+	}
+
+	err = c.Shutdown(ctx, 0)
+
+	if !errors.As(err, &e) || e.Status != 403 || e.Message != "forbidden" || !IsForbidden(err) {
+		t.Errorf("Shutdown: %#v", err)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	var lock sync.Mutex
+	calls := map[string]int{}
+
+	c := serve(t, func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		calls[r.Method+" "+r.URL.Path]++
+		n := calls[r.Method+" "+r.URL.Path]
+		lock.Unlock()
+
+		switch {
+		case r.URL.Path == "/diag" && n < 3, r.Method == "POST":
+			w.WriteHeader(503)
+			fmt.Fprint(w, `{"Status":503,"Message":"Unavailable"}`)
+		case r.URL.Path == "/ping":
+			w.WriteHeader(400)
+			fmt.Fprint(w, `{"Status":400,"Message":"Bad value","Key":"Primary"}`)
+		default:
+			fmt.Fprint(w, `{"JobsSubmitted":7}`)
+		}
+	})
+
+	ctx := context.Background()
+
+	if _, err := c.GetStatistics(ctx); err != nil || calls["GET /diag"] != 3 {
+		t.Errorf("GET: %v after %d calls, expected 3", err, calls["GET /diag"])
+	}
+
+	if err := c.Ping(ctx, 2); err == nil || calls["GET /ping"] != 1 {
+		t.Errorf("GET 400: %v after %d calls, expected 1", err, calls["GET /ping"])
+	}
+
+	if err := c.KillJob(ctx, 42, 9); !IsUnavailable(err) || calls["POST /job/kill"] != 1 {
+		t.Errorf("POST: %v after %d calls, expected 1", err, calls["POST /job/kill"])
+	}
+
+	c.Retries = 1
+	calls["GET /diag"] = 0
+
+	if _, err := c.GetStatistics(ctx); !IsUnavailable(err) || calls["GET /diag"] != 2 {
+		t.Errorf("GET with 1 retry: %v after %d calls, expected 2", err, calls["GET /diag"])
+	}
+}
+
+func TestWaitForJob(t *testing.T) {
+	var lock sync.Mutex
+	calls := 0
+
+	c := serve(t, func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		calls++
+		n := calls
+		lock.Unlock()
+
+		state := JobRunning
+		if n >= 3 {
+			state = JobComplete
+		}
+
+		fmt.Fprintf(w, `{"JobArray":[{"JobId":42,"JobState":%d}]}`, state)
+	})
+
+	job, err := c.WaitForJob(context.Background(), 42, time.Millisecond)
+
+	if err != nil || job.JobId != 42 || job.JobState != JobComplete || calls != 3 {
+		t.Errorf("job %+v, %v after %d calls", job, err, calls)
+	}
+
+	c = serve(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(404)
+		fmt.Fprint(w, `{"Status":404,"Errno":2017,"Name":"ESLURM_INVALID_JOB_ID","Message":"Invalid job id specified"}`)
+	})
+
+	if job, err := c.WaitForJob(context.Background(), 42, time.Millisecond); !IsNotFound(err) || job != nil {
+		t.Errorf("job %+v, %v, expected a 404", job, err)
+	}
+}
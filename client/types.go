@@ -0,0 +1,658 @@
+package client
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Value is an integer that slurm may leave unset, sent as null,
+// or make unlimited, sent as "unlimited".
+
+type Value struct {
+	Set       bool
+	Unlimited bool
+	Value     uint64
+}
+
+var Unlimited = Value{Set: true, Unlimited: true}
+
+func Uint(n uint64) Value {
+	return Value{Set: true, Value: n}
+}
+
+func (v Value) String() string {
+	switch {
+	case !v.Set:
+		return ""
+	case v.Unlimited:
+		return "UNLIMITED"
+	}
+	return strconv.FormatUint(v.Value, 10)
+}
+
+func (v Value) MarshalJSON() ([]byte, error) {
+	switch {
+	case !v.Set:
+		return []byte("null"), nil
+	case v.Unlimited:
+		return []byte(`"unlimited"`), nil
+	}
+	return []byte(strconv.FormatUint(v.Value, 10)), nil
+}
+
+func (v *Value) UnmarshalJSON(b []byte) error {
+	*v = Value{}
+
+	if string(b) == "null" {
+		return nil
+	}
+
+	if string(b) == `"unlimited"` {
+		*v = Unlimited
+		return nil
+	}
+
+	v.Set = true
+
+	return json.Unmarshal(b, &v.Value)
+}
+
+// Time is a time of a record, the zero time when it is unset.
+
+type Time struct {
+	time.Time
+	Unlimited bool
+}
+
+func (t Time) MarshalJSON() ([]byte, error) {
+	switch {
+	case t.Unlimited:
+		return []byte(`"unlimited"`), nil
+	case t.IsZero():
+		return []byte("null"), nil
+	}
+	return []byte(strconv.FormatInt(t.Unix(), 10)), nil
+}
+
+func (t *Time) UnmarshalJSON(b []byte) error {
+	*t = Time{}
+
+	var n int64
+
+	if json.Unmarshal(b, &n) == nil {
+		if n != 0 {
+			t.Time = time.Unix(n, 0)
+		}
+		return nil
+	}
+
+	var s *string
+
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+
+	switch {
+	case s == nil:
+		return nil
+	case *s == "unlimited":
+		t.Unlimited = true
+		return nil
+	}
+
+	var err error
+
+	t.Time, err = time.Parse(time.RFC3339, *s)
+
+	return err
+}
+
+// encode_keys sends the fields of a request that are set, by their
+// key, followed by the keys of Keys that have no field.
+
+func encode_keys(v interface{}, keys map[string]interface{}) map[string]interface{} {
+	ret := make(map[string]interface{})
+	val := reflect.ValueOf(v).Elem()
+
+	for i := 0; i < val.NumField(); i++ {
+		f := val.Type().Field(i)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		switch x := val.Field(i).Interface().(type) {
+		case Value:
+			if x.Set {
+				ret[name] = x
+			}
+		case Time:
+			if x.Unlimited || !x.IsZero() {
+				ret[name] = x
+			}
+		case string:
+			if x != "" {
+				ret[name] = x
+			}
+		case []string:
+			if x != nil {
+				ret[name] = x
+			}
+		}
+	}
+
+	for k, v := range keys {
+		if _, ok := ret[k]; !ok {
+			ret[k] = v
+		}
+	}
+
+	return ret
+}
+
+// decode_record decodes the typed fields of a record in v
+// and all its keys in keys.
+
+func decode_record(b []byte, v interface{}, keys *map[string]json.RawMessage) error {
+	if err := json.Unmarshal(b, v); err != nil {
+		return err
+	}
+	return json.Unmarshal(b, keys)
+}
+
+// JobDesc describes a job to submit, allocate, test or update,
+// Keys gives the other keys of job_desc_msg_t.
+
+type JobDesc struct {
+	JobId         Value
+	Name          string
+	Script        string
+	Argv          []string
+	Environment   []string
+	WorkDir       string
+	StdOut        string
+	StdErr        string
+	StdIn         string
+	Partition     string
+	Account       string
+	Qos           string
+	Reservation   string
+	Dependency    string
+	Comment       string
+	Features      string
+	ReqNodes      string
+	ExcNodes      string
+	TimeLimit     Value
+	TimeMin       Value
+	BeginTime     Time
+	MinNodes      Value
+	MaxNodes      Value
+	MinCpus       Value
+	NumTasks      Value
+	CpusPerTask   Value
+	NtasksPerNode Value
+	PnMinMemory   Value
+	Priority      Value
+	Requeue       Value
+	MailType      Value
+	MailUser      string
+	ArrayInx      string
+	UserId        Value
+	GroupId       Value
+
+	// sent with /job/submit to be called when the job ends
+	CallbackUrl string
+
+	Keys map[string]interface{} `json:"-"`
+}
+
+func (d *JobDesc) MarshalJSON() ([]byte, error) {
+	return json.Marshal(encode_keys(d, d.Keys))
+}
+
+type NodeUpdate struct {
+	NodeNames    string
+	NodeState    string
+	Reason       string
+	Features     string
+	FeaturesAct  string
+	Gres         string
+	Weight       Value
+	Comment      string
+	NodeAddr     string
+	NodeHostname string
+
+	Keys map[string]interface{} `json:"-"`
+}
+
+func (d *NodeUpdate) MarshalJSON() ([]byte, error) {
+	return json.Marshal(encode_keys(d, d.Keys))
+}
+
+type FrontEndUpdate struct {
+	Name      string
+	NodeState string
+	Reason    string
+
+	Keys map[string]interface{} `json:"-"`
+}
+
+func (d *FrontEndUpdate) MarshalJSON() ([]byte, error) {
+	return json.Marshal(encode_keys(d, d.Keys))
+}
+
+type PartitionDesc struct {
+	Name          string
+	Nodes         string
+	StateUp       string
+	Flags         string
+	MaxTime       Value
+	DefaultTime   Value
+	MaxNodes      Value
+	MinNodes      Value
+	Alternate     string
+	AllowAccounts string
+	AllowGroups   string
+	AllowQos      string
+	DenyAccounts  string
+	DenyQos       string
+	PriorityTier  Value
+
+	Keys map[string]interface{} `json:"-"`
+}
+
+func (d *PartitionDesc) MarshalJSON() ([]byte, error) {
+	return json.Marshal(encode_keys(d, d.Keys))
+}
+
+type ReservationDesc struct {
+	Name      string
+	StartTime Time
+	EndTime   Time
+	Duration  Value
+	NodeList  string
+	Partition string
+	Users     string
+	Accounts  string
+	Features  string
+	Licenses  string
+	Flags     string
+
+	// number of nodes, or of cores, by the Slurm name
+	NodeCnt []uint32
+	CoreCnt []uint32
+
+	Keys map[string]interface{} `json:"-"`
+}
+
+func (d *ReservationDesc) MarshalJSON() ([]byte, error) {
+	ret := encode_keys(d, d.Keys)
+
+	if d.NodeCnt != nil {
+		ret["NodeCnt"] = d.NodeCnt
+	}
+	if d.CoreCnt != nil {
+		ret["CoreCnt"] = d.CoreCnt
+	}
+
+	return json.Marshal(ret)
+}
+
+type TriggerDesc struct {
+	TrigId   Value
+	ResType  Value
+	ResId    string
+	TrigType Value
+	Offset   Value
+	UserId   Value
+	Program  string
+
+	Keys map[string]interface{} `json:"-"`
+}
+
+func (d *TriggerDesc) MarshalJSON() ([]byte, error) {
+	return json.Marshal(encode_keys(d, d.Keys))
+}
+
+// the base states of a job, in JobState & JobStateBase
+
+const (
+	JobPending = iota
+	JobRunning
+	JobSuspended
+	JobComplete
+	JobCancelled
+	JobFailed
+	JobTimeout
+	JobNodeFail
+	JobPreempted
+	JobBootFail
+	JobDeadline
+	JobOOM
+
+	JobStateBase = 0xff
+)
+
+type Job struct {
+	JobId           uint32
+	ArrayJobId      Value
+	ArrayTaskId     Value
+	Name            string
+	UserId          uint32
+	GroupId         uint32
+	Account         string
+	Partition       string
+	JobState        uint32
+	JobStateName    string
+	StateReason     uint32
+	StateReasonName string
+	StateDesc       string
+	Nodes           string
+	NumNodes        Value
+	NumCpus         Value
+	TimeLimit       Value
+	Priority        Value
+	SubmitTime      Time
+	StartTime       Time
+	EndTime         Time
+	ExitCode        Value
+	WorkDir         string
+	StdOut          string
+	StdErr          string
+	Command         string
+
+	Keys map[string]json.RawMessage `json:"-"`
+}
+
+func (j *Job) UnmarshalJSON(b []byte) error {
+	type plain Job
+	return decode_record(b, (*plain)(j), &j.Keys)
+}
+
+// Finished is true once the job can't run anymore.
+
+func (j *Job) Finished() bool {
+	return j.JobState&JobStateBase >= JobComplete
+}
+
+type JobList struct {
+	LastUpdate  Time
+	RecordCount uint32
+	Jobs        []Job `json:"JobArray"`
+	NextCursor  *int
+}
+
+type JobStep struct {
+	JobId     uint32
+	StepId    uint32
+	Name      string
+	UserId    uint32
+	Partition string
+	Nodes     string
+	NumCpus   Value
+	NumTasks  Value
+	State     uint32
+	StartTime Time
+	RunTime   Value
+	TimeLimit Value
+
+	Keys map[string]json.RawMessage `json:"-"`
+}
+
+func (s *JobStep) UnmarshalJSON(b []byte) error {
+	type plain JobStep
+	return decode_record(b, (*plain)(s), &s.Keys)
+}
+
+type JobStepList struct {
+	LastUpdate   Time
+	JobStepCount uint32
+	Steps        []JobStep `json:"JobSteps"`
+}
+
+type SubmitResponse struct {
+	JobId            uint32
+	StepId           Value
+	ErrorCode        uint32
+	JobSubmitUserMsg string
+}
+
+type Allocation struct {
+	JobId       uint32
+	NodeList    string
+	NodeCnt     Value
+	Partition   string
+	Account     string
+	Qos         string
+	PnMinMemory Value
+	ErrorCode   uint32
+
+	Keys map[string]json.RawMessage `json:"-"`
+}
+
+func (a *Allocation) UnmarshalJSON(b []byte) error {
+	type plain Allocation
+	return decode_record(b, (*plain)(a), &a.Keys)
+}
+
+type WillRun struct {
+	JobId          uint32
+	NodeList       string
+	PartName       string
+	ProcCnt        Value
+	StartTime      Time
+	PreempteeJobId []uint32
+}
+
+type Node struct {
+	Name           string
+	NodeAddr       string
+	NodeHostname   string
+	NodeState      uint32
+	NodeStateName  string
+	NodeStateFlags []string
+	Partitions     string
+	Cpus           Value
+	CpuLoad        Value
+	Sockets        Value
+	Cores          Value
+	Threads        Value
+	RealMemory     Value
+	FreeMem        Value
+	TmpDisk        Value
+	Weight         Value
+	Features       string
+	Gres           string
+	Arch           string
+	Os             string
+	Reason         string
+	ReasonTime     Time
+	BootTime       Time
+	Version        string
+
+	Keys map[string]json.RawMessage `json:"-"`
+}
+
+func (n *Node) UnmarshalJSON(b []byte) error {
+	type plain Node
+	return decode_record(b, (*plain)(n), &n.Keys)
+}
+
+type NodeList struct {
+	LastUpdate  Time
+	RecordCount uint32
+	Nodes       []Node `json:"NodeArray"`
+	NextCursor  *int
+}
+
+type FrontEnd struct {
+	Name          string
+	NodeState     uint32
+	NodeStateName string
+	Reason        string
+	BootTime      Time
+	Version       string
+
+	Keys map[string]json.RawMessage `json:"-"`
+}
+
+func (f *FrontEnd) UnmarshalJSON(b []byte) error {
+	type plain FrontEnd
+	return decode_record(b, (*plain)(f), &f.Keys)
+}
+
+type FrontEndList struct {
+	LastUpdate  Time
+	RecordCount uint32
+	FrontEnds   []FrontEnd `json:"FrontEndArray"`
+}
+
+type Partition struct {
+	Name        string
+	Nodes       string
+	StateUp     Value
+	StateUpName string
+	Flags       Value
+	FlagNames   []string
+	TotalCpus   Value
+	TotalNodes  Value
+	MaxTime     Value
+	DefaultTime Value
+	MaxNodes    Value
+	MinNodes    Value
+
+	Keys map[string]json.RawMessage `json:"-"`
+}
+
+func (p *Partition) UnmarshalJSON(b []byte) error {
+	type plain Partition
+	return decode_record(b, (*plain)(p), &p.Keys)
+}
+
+type PartitionList struct {
+	LastUpdate  Time
+	RecordCount uint32
+	Partitions  []Partition `json:"PartitionArray"`
+}
+
+type Reservation struct {
+	Name      string
+	NodeList  string
+	NodeCnt   Value
+	CoreCnt   Value
+	Partition string
+	StartTime Time
+	EndTime   Time
+	Users     string
+	Accounts  string
+	Features  string
+	Licenses  string
+	Flags     Value
+	FlagNames []string
+
+	Keys map[string]json.RawMessage `json:"-"`
+}
+
+func (r *Reservation) UnmarshalJSON(b []byte) error {
+	type plain Reservation
+	return decode_record(b, (*plain)(r), &r.Keys)
+}
+
+type ReservationList struct {
+	LastUpdate   Time
+	RecordCount  uint32
+	Reservations []Reservation `json:"ReservationArray"`
+}
+
+type License struct {
+	Name      string
+	Total     Value
+	InUse     Value
+	Available Value
+	Remote    Value
+}
+
+type LicenseList struct {
+	LastUpdate Time
+	NumLic     uint32
+	Licenses   []License `json:"LicArray"`
+}
+
+type Trigger struct {
+	TrigId   uint32
+	ResType  Value
+	ResId    string
+	TrigType Value
+	Offset   Value
+	UserId   uint32
+	Program  string
+	Flags    Value
+}
+
+type TriggerList struct {
+	RecordCount uint32
+	Triggers    []Trigger `json:"TriggerArray"`
+}
+
+type Switch struct {
+	Name      string
+	Level     Value
+	LinkSpeed Value
+	Nodes     string
+	Switches  string
+}
+
+type Topology struct {
+	RecordCount uint32
+	Switches    []Switch `json:"TopoArray"`
+}
+
+type RpcStat struct {
+	Count       uint64
+	TotalTime   uint64
+	AverageTime uint64
+}
+
+type Statistics struct {
+	ReqTime          Time
+	ReqTimeStart     Time
+	JobsSubmitted    Value
+	JobsStarted      Value
+	JobsCompleted    Value
+	JobsCanceled     Value
+	JobsFailed       Value
+	JobsPending      Value
+	JobsRunning      Value
+	AgentQueueSize   Value
+	BfActive         Value
+	BfLastDepth      Value
+	RpcTypeStats     map[string]RpcStat
+	RpcUserStats     map[string]RpcStat
+	ScheduleQueueLen Value
+
+	Keys map[string]json.RawMessage `json:"-"`
+}
+
+func (s *Statistics) UnmarshalJSON(b []byte) error {
+	type plain Statistics
+	return decode_record(b, (*plain)(s), &s.Keys)
+}
+
+type Conf struct {
+	LastUpdate     Time
+	ClusterName    string
+	ControlMachine []string
+	SlurmConf      string
+
+	Keys map[string]json.RawMessage `json:"-"`
+}
+
+func (c *Conf) UnmarshalJSON(b []byte) error {
+	type plain Conf
+	return decode_record(b, (*plain)(c), &c.Keys)
+}
@@ -0,0 +1,166 @@
+// Command slurm-https-client submits, lists and cancels jobs and
+// lists nodes through a slurm-https server, like sbatch, squeue,
+// scancel and sinfo on a machine without Slurm.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/angt/slurm-https/client"
+)
+
+var commands = map[string]func(context.Context, *client.Client, []string) error{
+	"submit": submit,
+	"queue":  queue,
+	"cancel": cancel,
+	"nodes":  nodes,
+}
+
+func env(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), `Usage: %s [flags] command [options] [args]
+
+Commands:
+  submit [options] [script [args]]   submit a batch job, like sbatch
+  queue [options]                    list the jobs, like squeue
+  cancel [options] job[.step]...     cancel jobs or steps, like scancel
+  nodes [options]                    list the nodes, like sinfo
+
+Flags:
+`, os.Args[0])
+	flag.PrintDefaults()
+}
+
+func main() {
+	var (
+		addr = flag.String("url", env("SLURM_HTTPS_URL", "https://localhost:8443"), "url of the server, or $SLURM_HTTPS_URL")
+		cert = flag.String("cert", env("SLURM_HTTPS_CERT", "client.crt"), "certificate, or $SLURM_HTTPS_CERT")
+		key  = flag.String("key", env("SLURM_HTTPS_KEY", "client.key"), "certificate key, or $SLURM_HTTPS_KEY")
+		ca   = flag.String("ca", env("SLURM_HTTPS_CA", "ca.crt"), "ca certificate, or $SLURM_HTTPS_CA")
+	)
+
+	flag.Usage = usage
+	flag.Parse()
+
+	log.SetFlags(0)
+	log.SetPrefix(os.Args[0] + ": ")
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[flag.Arg(0)]
+
+	if !ok {
+		log.Fatalf("unknown command %q", flag.Arg(0))
+	}
+
+	c, err := client.Dial(*addr, *cert, *key, *ca)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := cmd(context.Background(), c, flag.Args()[1:]); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// option is an option of a command, -s or --long, with an argument
+// given as -s arg, -sarg, --long arg or --long=arg when arg is set.
+
+type option struct {
+	short string
+	long  string
+	arg   bool
+	fn    func(string) error
+}
+
+// parse_options calls the options found anywhere in args and returns
+// the other args, everything after -- is returned as is.
+
+func parse_options(opts []option, args []string) ([]string, error) {
+	var rest []string
+
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+
+		if a == "--" {
+			return append(rest, args[i+1:]...), nil
+		}
+
+		if len(a) < 2 || a[0] != '-' {
+			rest = append(rest, a)
+			continue
+		}
+
+		var o *option
+		var val string
+		var has_val bool
+
+		if strings.HasPrefix(a, "--") {
+			name := a[2:]
+			if j := strings.IndexByte(name, '='); j >= 0 {
+				name, val, has_val = name[:j], name[j+1:], true
+			}
+			for k := range opts {
+				if opts[k].long == name {
+					o = &opts[k]
+				}
+			}
+		} else {
+			for k := range opts {
+				if opts[k].short != "" && opts[k].short == a[1:2] {
+					o = &opts[k]
+				}
+			}
+			if len(a) > 2 {
+				val, has_val = a[2:], true
+			}
+		}
+
+		if o == nil || (has_val && !o.arg) {
+			return nil, fmt.Errorf("unknown option %s", a)
+		}
+
+		if o.arg && !has_val {
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("option %s needs an argument", a)
+			}
+			i++
+			val = args[i]
+		}
+
+		if err := o.fn(val); err != nil {
+			return nil, fmt.Errorf("option %s: %v", a, err)
+		}
+	}
+
+	return rest, nil
+}
+
+func list(dst *[]string) func(string) error {
+	return func(s string) error {
+		*dst = append(*dst, strings.Split(s, ",")...)
+		return nil
+	}
+}
+
+func set(dst *bool) func(string) error {
+	return func(string) error {
+		*dst = true
+		return nil
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/angt/slurm-https/client"
+)
+
+// hostlist compresses names like sinfo, node1,node2,node3,gpu1
+// becomes node[1-3],gpu1.
+
+func hostlist(names []string) string {
+	type group struct {
+		prefix string
+		nums   []string
+	}
+
+	var groups []*group
+	var ret []string
+
+	for _, name := range names {
+		i := len(name)
+		for i > 0 && name[i-1] >= '0' && name[i-1] <= '9' {
+			i--
+		}
+		if i == len(name) {
+			groups = append(groups, &group{prefix: name})
+			continue
+		}
+		if n := len(groups); n > 0 && groups[n-1].prefix == name[:i] && groups[n-1].nums != nil {
+			groups[n-1].nums = append(groups[n-1].nums, name[i:])
+			continue
+		}
+		groups = append(groups, &group{prefix: name[:i], nums: []string{name[i:]}})
+	}
+
+	for _, g := range groups {
+		if len(g.nums) == 0 {
+			ret = append(ret, g.prefix)
+			continue
+		}
+		if len(g.nums) == 1 {
+			ret = append(ret, g.prefix+g.nums[0])
+			continue
+		}
+
+		var ranges []string
+
+		for i := 0; i < len(g.nums); {
+			j := i
+			for j+1 < len(g.nums) && next(g.nums[j], g.nums[j+1]) {
+				j++
+			}
+			if i == j {
+				ranges = append(ranges, g.nums[i])
+			} else {
+				ranges = append(ranges, g.nums[i]+"-"+g.nums[j])
+			}
+			i = j + 1
+		}
+
+		ret = append(ret, g.prefix+"["+strings.Join(ranges, ",")+"]")
+	}
+
+	return strings.Join(ret, ",")
+}
+
+// next is true when b follows a with the same width, like 09 and 10.
+
+func next(a, b string) bool {
+	x, _ := strconv.Atoi(a)
+	y, _ := strconv.Atoi(b)
+	return len(a) == len(b) && y == x+1
+}
+
+// time_limit formats minutes like sinfo.
+
+func time_limit(v client.Value) string {
+	switch {
+	case !v.Set:
+		return "n/a"
+	case v.Unlimited:
+		return "infinite"
+	}
+
+	m := v.Value
+
+	if m >= 24*60 {
+		return fmt.Sprintf("%d-%02d:%02d:00", m/(24*60), m/60%24, m%60)
+	}
+
+	return fmt.Sprintf("%d:%02d:00", m/60, m%60)
+}
+
+// the short states of sinfo, by base state
+
+var node_states = []string{"unk", "down", "idle", "alloc", "err", "mix", "future"}
+
+func node_state(n *client.Node) string {
+	base := int(n.NodeState & 0xf)
+	s := strconv.Itoa(base)
+
+	if base < len(node_states) {
+		s = node_states[base]
+	}
+
+	if contains(n.NodeStateFlags, "DRAIN") {
+		if s == "idle" || s == "down" {
+			s = "drain"
+		} else {
+			s = "drng"
+		}
+	}
+
+	if contains(n.NodeStateFlags, "NO_RESPOND") {
+		s += "*"
+	}
+
+	return s
+}
+
+// nodes lists the nodes by partition and state, or one per line
+// with -N, like sinfo.
+
+func nodes(ctx context.Context, c *client.Client, args []string) error {
+	var (
+		opt       client.ListOptions
+		no_header bool
+		long      bool
+	)
+
+	rest, err := parse_options([]option{
+		{"p", "partition", true, list(&opt.Partitions)},
+		{"t", "states", true, list(&opt.States)},
+		{"n", "nodes", true, list(&opt.Names)},
+		{"h", "noheader", false, set(&no_header)},
+		{"N", "Node", false, set(&long)},
+	}, args)
+
+	if err != nil {
+		return err
+	}
+
+	if len(rest) > 0 {
+		return fmt.Errorf("unexpected argument %q", rest[0])
+	}
+
+	res, err := c.LoadNodes(ctx, &opt)
+
+	if err != nil {
+		return err
+	}
+
+	parts, err := c.LoadPartitions(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	if long {
+		if !no_header {
+			fmt.Fprintln(w, "NODELIST\tNODES\tPARTITION\tSTATE\tCPUS\tMEMORY\tREASON")
+		}
+		for i := range res.Nodes {
+			n := &res.Nodes[i]
+			for _, p := range strings.Split(n.Partitions, ",") {
+				fmt.Fprintf(w, "%s\t1\t%s\t%s\t%s\t%s\t%s\n",
+					n.Name, p, node_state(n), n.Cpus, n.RealMemory, n.Reason)
+			}
+		}
+		return w.Flush()
+	}
+
+	if !no_header {
+		fmt.Fprintln(w, "PARTITION\tAVAIL\tTIMELIMIT\tNODES\tSTATE\tNODELIST")
+	}
+
+	for i := range parts.Partitions {
+		p := &parts.Partitions[i]
+
+		if len(opt.Partitions) > 0 && !contains(opt.Partitions, p.Name) {
+			continue
+		}
+
+		var states []string
+		names := map[string][]string{}
+
+		for j := range res.Nodes {
+			n := &res.Nodes[j]
+			if !contains(strings.Split(n.Partitions, ","), p.Name) {
+				continue
+			}
+			s := node_state(n)
+			if _, ok := names[s]; !ok {
+				states = append(states, s)
+			}
+			names[s] = append(names[s], n.Name)
+		}
+
+		name := p.Name
+
+		if contains(p.FlagNames, "DEFAULT") {
+			name += "*"
+		}
+
+		for _, s := range states {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\n",
+				name, strings.ToLower(p.StateUpName), time_limit(p.MaxTime),
+				len(names[s]), s, hostlist(names[s]))
+		}
+	}
+
+	return w.Flush()
+}
+
+func contains(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/angt/slurm-https/client"
+)
+
+// the compact states of squeue, by base state
+
+var job_states = []string{"PD", "R", "S", "CD", "CA", "F", "TO", "NF", "PR", "BF", "DL", "OOM"}
+
+const (
+	job_configuring = 0x4000
+	job_completing  = 0x8000
+)
+
+func job_state(j *client.Job) string {
+	switch {
+	case j.JobState&job_completing != 0:
+		return "CG"
+	case j.JobState&job_configuring != 0:
+		return "CF"
+	}
+
+	if s := int(j.JobState & client.JobStateBase); s < len(job_states) {
+		return job_states[s]
+	}
+
+	return strconv.Itoa(int(j.JobState))
+}
+
+// duration formats a time like squeue: [days-]hours:minutes:seconds
+// or minutes:seconds.
+
+func duration(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+
+	s := int(d / time.Second)
+	days, h, m := s/86400, s/3600%24, s/60%60
+	s %= 60
+
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%d-%02d:%02d:%02d", days, h, m, s)
+	case h > 0:
+		return fmt.Sprintf("%d:%02d:%02d", h, m, s)
+	}
+
+	return fmt.Sprintf("%d:%02d", m, s)
+}
+
+func run_time(j *client.Job) time.Duration {
+	switch {
+	case j.StartTime.IsZero() || j.JobState&client.JobStateBase == client.JobPending:
+		return 0
+	case j.JobState&client.JobStateBase == client.JobRunning:
+		return time.Since(j.StartTime.Time)
+	case !j.EndTime.IsZero():
+		return j.EndTime.Sub(j.StartTime.Time)
+	}
+	return 0
+}
+
+// user_name is the local name of a uid, or the uid.
+
+func user_name(uid uint32) string {
+	id := strconv.FormatUint(uint64(uid), 10)
+
+	if u, err := user.LookupId(id); err == nil {
+		return u.Username
+	}
+
+	return id
+}
+
+func queue(ctx context.Context, c *client.Client, args []string) error {
+	var (
+		opt       client.ListOptions
+		no_header bool
+		me        bool
+	)
+
+	rest, err := parse_options([]option{
+		{"u", "user", true, list(&opt.Users)},
+		{"p", "partition", true, list(&opt.Partitions)},
+		{"t", "states", true, list(&opt.States)},
+		{"n", "name", true, list(&opt.Names)},
+		{"S", "sort", true, list(&opt.Sort)},
+		{"h", "noheader", false, set(&no_header)},
+		{"", "me", false, set(&me)},
+	}, args)
+
+	if err != nil {
+		return err
+	}
+
+	if len(rest) > 0 {
+		return fmt.Errorf("unexpected argument %q", rest[0])
+	}
+
+	if me {
+		u, err := user.Current()
+		if err != nil {
+			return err
+		}
+		opt.Users = append(opt.Users, u.Username)
+	}
+
+	res, err := c.LoadJobs(ctx, &opt)
+
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	if !no_header {
+		fmt.Fprintln(w, "JOBID\tPARTITION\tNAME\tUSER\tST\tTIME\tNODES\tNODELIST(REASON)")
+	}
+
+	for i := range res.Jobs {
+		j := &res.Jobs[i]
+
+		nodes := j.Nodes
+
+		if j.JobState&client.JobStateBase == client.JobPending && j.StateReasonName != "" {
+			nodes = "(" + j.StateReasonName + ")"
+		}
+
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			j.JobId, j.Partition, j.Name, user_name(j.UserId),
+			job_state(j), duration(run_time(j)), j.NumNodes, nodes)
+	}
+
+	return w.Flush()
+}
+
+// cancel kills jobs, or steps given as job.step, like scancel,
+// it goes on with the next ids after an error.
+
+func cancel(ctx context.Context, c *client.Client, args []string) error {
+	signal := 9
+
+	rest, err := parse_options([]option{
+		{"s", "signal", true, func(s string) error {
+			n, err := parse_signal(s)
+			signal = n
+			return err
+		}},
+	}, args)
+
+	if err != nil {
+		return err
+	}
+
+	if len(rest) == 0 {
+		return fmt.Errorf("no job id specified")
+	}
+
+	var last error
+
+	for _, a := range rest {
+		if err := cancel_job(ctx, c, a, signal); err != nil {
+			last = fmt.Errorf("%s: %v", a, err)
+			if len(rest) > 1 {
+				fmt.Fprintln(os.Stderr, last)
+			}
+		}
+	}
+
+	if last != nil && len(rest) > 1 {
+		return fmt.Errorf("could not cancel every job")
+	}
+
+	return last
+}
+
+func cancel_job(ctx context.Context, c *client.Client, id string, signal int) error {
+	p := strings.SplitN(id, ".", 2)
+
+	job, err := strconv.ParseUint(p[0], 10, 32)
+
+	if err != nil {
+		return fmt.Errorf("invalid job id")
+	}
+
+	if len(p) == 1 {
+		return c.KillJob(ctx, uint32(job), signal)
+	}
+
+	step, err := strconv.ParseUint(p[1], 10, 32)
+
+	if err != nil {
+		return fmt.Errorf("invalid step id")
+	}
+
+	return c.KillJobStep(ctx, uint32(job), uint32(step), signal)
+}
+
+var signals = map[string]int{
+	"HUP": 1, "INT": 2, "QUIT": 3, "KILL": 9, "USR1": 10,
+	"USR2": 12, "TERM": 15, "CONT": 18, "STOP": 19, "TSTP": 20,
+}
+
+func parse_signal(s string) (int, error) {
+	if n, err := strconv.Atoi(s); err == nil && n > 0 {
+		return n, nil
+	}
+
+	if n, ok := signals[strings.TrimPrefix(strings.ToUpper(s), "SIG")]; ok {
+		return n, nil
+	}
+
+	return 0, fmt.Errorf("invalid signal %q", s)
+}
@@ -0,0 +1,495 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/angt/slurm-https/client"
+)
+
+// parse_minutes parses a time limit of sbatch: minutes, minutes:seconds,
+// hours:minutes:seconds, days-hours, days-hours:minutes or
+// days-hours:minutes:seconds, rounded up to the minute.
+
+func parse_minutes(s string) (client.Value, error) {
+	switch strings.ToLower(s) {
+	case "unlimited", "infinite", "-1":
+		return client.Unlimited, nil
+	}
+
+	days := -1
+
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		n, err := strconv.Atoi(s[:i])
+		if err != nil || n < 0 {
+			return client.Value{}, fmt.Errorf("invalid time %q", s)
+		}
+		days, s = n, s[i+1:]
+	}
+
+	var p []int
+
+	for _, f := range strings.Split(s, ":") {
+		n, err := strconv.Atoi(f)
+		if err != nil || n < 0 {
+			return client.Value{}, fmt.Errorf("invalid time %q", s)
+		}
+		p = append(p, n)
+	}
+
+	if len(p) > 3 {
+		return client.Value{}, fmt.Errorf("invalid time %q", s)
+	}
+
+	var secs int
+
+	if days >= 0 {
+		p = append(p, 0, 0)
+		secs = days*86400 + p[0]*3600 + p[1]*60 + p[2]
+	} else {
+		switch len(p) {
+		case 1:
+			secs = p[0] * 60
+		case 2:
+			secs = p[0]*60 + p[1]
+		case 3:
+			secs = p[0]*3600 + p[1]*60 + p[2]
+		}
+	}
+
+	return client.Uint(uint64((secs + 59) / 60)), nil
+}
+
+// parse_mb parses a size in megabytes, or with a K, M, G or T suffix.
+
+func parse_mb(s string) (uint64, error) {
+	mult := map[byte]float64{'K': 1.0 / 1024, 'M': 1, 'G': 1024, 'T': 1024 * 1024}
+	m := 1.0
+
+	if n := len(s); n > 0 {
+		if v, ok := mult[strings.ToUpper(s)[n-1]]; ok {
+			m, s = v, s[:n-1]
+		}
+	}
+
+	n, err := strconv.ParseUint(s, 10, 64)
+
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+
+	mb := float64(n) * m
+
+	if mb > 0 && mb < 1 {
+		mb = 1
+	}
+
+	return uint64(mb), nil
+}
+
+var begin_units = map[string]time.Duration{
+	"":        time.Second,
+	"second":  time.Second,
+	"seconds": time.Second,
+	"minute":  time.Minute,
+	"minutes": time.Minute,
+	"hour":    time.Hour,
+	"hours":   time.Hour,
+	"day":     24 * time.Hour,
+	"days":    24 * time.Hour,
+	"week":    7 * 24 * time.Hour,
+	"weeks":   7 * 24 * time.Hour,
+}
+
+// parse_begin parses a begin time of sbatch: now[+count[units]],
+// HH:MM[:SS] or YYYY-MM-DD[THH:MM[:SS]], in the local time zone.
+
+func parse_begin(s string) (client.Time, error) {
+	now := time.Now()
+
+	if low := strings.ToLower(s); strings.HasPrefix(low, "now") {
+		s = low
+		if s == "now" {
+			return client.Time{Time: now}, nil
+		}
+		if s[3] != '+' {
+			return client.Time{}, fmt.Errorf("invalid time %q", s)
+		}
+		num := strings.TrimRight(s[4:], "abcdefghijklmnopqrstuvwxyz")
+		n, err := strconv.Atoi(num)
+		if err != nil {
+			return client.Time{}, fmt.Errorf("invalid time %q", s)
+		}
+		u, ok := begin_units[s[4+len(num):]]
+		if !ok {
+			return client.Time{}, fmt.Errorf("invalid time %q", s)
+		}
+		return client.Time{Time: now.Add(time.Duration(n) * u)}, nil
+	}
+
+	for _, layout := range []string{"15:04", "15:04:05"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			t = time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.Local)
+			if t.Before(now) {
+				t = t.AddDate(0, 0, 1)
+			}
+			return client.Time{Time: t}, nil
+		}
+	}
+
+	for _, layout := range []string{"2006-01-02", "2006-01-02T15:04", "2006-01-02T15:04:05"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return client.Time{Time: t}, nil
+		}
+	}
+
+	return client.Time{}, fmt.Errorf("invalid time %q", s)
+}
+
+var mail_types = map[string]uint64{
+	"NONE":          0,
+	"BEGIN":         0x0001,
+	"END":           0x0002,
+	"FAIL":          0x0004,
+	"REQUEUE":       0x0008,
+	"TIME_LIMIT":    0x0010,
+	"TIME_LIMIT_90": 0x0020,
+	"TIME_LIMIT_80": 0x0040,
+	"TIME_LIMIT_50": 0x0080,
+	"STAGE_OUT":     0x0100,
+	"ARRAY_TASKS":   0x0200,
+	"ALL":           0x010f,
+}
+
+// job_options are the options of sbatch sent as keys of job_desc_msg_t.
+
+func job_options(desc *client.JobDesc, export *string) []option {
+	str := func(dst *string) func(string) error {
+		return func(s string) error {
+			*dst = s
+			return nil
+		}
+	}
+
+	num := func(dst *client.Value) func(string) error {
+		return func(s string) error {
+			n, err := strconv.ParseUint(s, 10, 32)
+			if err != nil {
+				return fmt.Errorf("invalid number %q", s)
+			}
+			*dst = client.Uint(n)
+			return nil
+		}
+	}
+
+	key := func(name string, v interface{}) func(string) error {
+		return func(string) error {
+			desc.Keys[name] = v
+			return nil
+		}
+	}
+
+	mem := func(per_cpu bool) func(string) error {
+		return func(s string) error {
+			mb, err := parse_mb(s)
+			if err != nil {
+				return err
+			}
+			if per_cpu {
+				mb |= 1 << 63
+			}
+			desc.PnMinMemory = client.Uint(mb)
+			return nil
+		}
+	}
+
+	return []option{
+		{"J", "job-name", true, str(&desc.Name)},
+		{"p", "partition", true, str(&desc.Partition)},
+		{"A", "account", true, str(&desc.Account)},
+		{"q", "qos", true, str(&desc.Qos)},
+		{"", "reservation", true, str(&desc.Reservation)},
+		{"d", "dependency", true, str(&desc.Dependency)},
+		{"", "comment", true, str(&desc.Comment)},
+		{"C", "constraint", true, str(&desc.Features)},
+		{"w", "nodelist", true, str(&desc.ReqNodes)},
+		{"x", "exclude", true, str(&desc.ExcNodes)},
+		{"o", "output", true, str(&desc.StdOut)},
+		{"e", "error", true, str(&desc.StdErr)},
+		{"i", "input", true, str(&desc.StdIn)},
+		{"D", "chdir", true, str(&desc.WorkDir)},
+		{"", "workdir", true, str(&desc.WorkDir)},
+		{"a", "array", true, str(&desc.ArrayInx)},
+		{"", "mail-user", true, str(&desc.MailUser)},
+		{"", "export", true, str(export)},
+		{"n", "ntasks", true, num(&desc.NumTasks)},
+		{"c", "cpus-per-task", true, num(&desc.CpusPerTask)},
+		{"", "ntasks-per-node", true, num(&desc.NtasksPerNode)},
+		{"", "mincpus", true, num(&desc.MinCpus)},
+		{"", "nice", true, func(s string) error {
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				return fmt.Errorf("invalid number %q", s)
+			}
+			desc.Keys["Nice"] = 0x80000000 + n
+			return nil
+		}},
+		{"", "mem", true, mem(false)},
+		{"", "mem-per-cpu", true, mem(true)},
+		{"", "hold", false, func(string) error {
+			desc.Priority = client.Uint(0)
+			return nil
+		}},
+		{"", "requeue", false, func(string) error {
+			desc.Requeue = client.Uint(1)
+			return nil
+		}},
+		{"", "no-requeue", false, func(string) error {
+			desc.Requeue = client.Uint(0)
+			return nil
+		}},
+		{"", "exclusive", false, key("Shared", 0)},
+		{"", "oversubscribe", false, key("Shared", 1)},
+		{"t", "time", true, func(s string) (err error) {
+			desc.TimeLimit, err = parse_minutes(s)
+			return
+		}},
+		{"", "time-min", true, func(s string) (err error) {
+			desc.TimeMin, err = parse_minutes(s)
+			return
+		}},
+		{"b", "begin", true, func(s string) (err error) {
+			desc.BeginTime, err = parse_begin(s)
+			return
+		}},
+		{"N", "nodes", true, func(s string) error {
+			p := strings.SplitN(s, "-", 2)
+			if err := num(&desc.MinNodes)(p[0]); err != nil {
+				return err
+			}
+			if len(p) == 2 {
+				return num(&desc.MaxNodes)(p[1])
+			}
+			return nil
+		}},
+		{"", "mail-type", true, func(s string) error {
+			var v uint64
+			for _, name := range strings.Split(s, ",") {
+				m, ok := mail_types[strings.ToUpper(name)]
+				if !ok {
+					return fmt.Errorf("invalid mail type %q", name)
+				}
+				v |= m
+			}
+			desc.MailType = client.Uint(v)
+			return nil
+		}},
+	}
+}
+
+// directives returns the #SBATCH options of a script, found in its
+// first comments like sbatch.
+
+func directives(script string) []string {
+	var ret []string
+
+	s := bufio.NewScanner(strings.NewReader(script))
+
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+
+		if line == "" {
+			continue
+		}
+
+		if !strings.HasPrefix(line, "#") {
+			break
+		}
+
+		if !strings.HasPrefix(line, "#SBATCH") {
+			continue
+		}
+
+		ret = append(ret, split_directive(line[len("#SBATCH"):])...)
+	}
+
+	return ret
+}
+
+// split_directive splits the options of a #SBATCH line like a shell:
+// on spaces out of quotes, the quotes removed, up to a word starting
+// with #, so that --job-name="my job" is a single option.
+
+func split_directive(line string) []string {
+	var ret []string
+	var word strings.Builder
+	var quote rune
+
+	in_word := false
+
+	for _, c := range line {
+		switch {
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+			word.WriteRune(c)
+		case c == '"' || c == '\'':
+			quote, in_word = c, true
+		case c == '#' && !in_word:
+			return ret
+		case unicode.IsSpace(c):
+			if in_word {
+				ret = append(ret, word.String())
+				word.Reset()
+				in_word = false
+			}
+		default:
+			word.WriteRune(c)
+			in_word = true
+		}
+	}
+
+	if in_word {
+		ret = append(ret, word.String())
+	}
+
+	return ret
+}
+
+// environment returns the variables of --export: ALL, NONE, or a list
+// of names or NAME=value, with ALL or NONE first. With NONE the job
+// gets the environment of a login of the user on its node, as sbatch
+// asks with SLURM_GET_USER_ENV.
+
+func environment(export string) []string {
+	var ret []string
+
+	for i, v := range strings.Split(export, ",") {
+		switch {
+		case i == 0 && v == "ALL":
+			ret = append(ret, os.Environ()...)
+		case i == 0 && v == "NONE":
+			ret = append(ret, "SLURM_GET_USER_ENV=1")
+		case strings.Contains(v, "="):
+			ret = append(ret, v)
+		default:
+			if val, ok := os.LookupEnv(v); ok {
+				ret = append(ret, v+"="+val)
+			}
+		}
+	}
+
+	return append(ret, "SLURM_EXPORT_ENV="+export)
+}
+
+func submit(ctx context.Context, c *client.Client, args []string) error {
+	// unlike sbatch, the local environment is only sent when asked
+	// for, it is the one of another machine
+
+	var (
+		desc     = &client.JobDesc{Keys: map[string]interface{}{}}
+		export   = "NONE"
+		parsable bool
+	)
+
+	opts := append(job_options(desc, &export),
+		option{"", "parsable", false, set(&parsable)},
+	)
+
+	// the options are parsed once to find the script, and again
+	// after its directives to take precedence over them
+
+	rest, err := parse_options(opts, args)
+
+	if err != nil {
+		return err
+	}
+
+	path := "-"
+
+	if len(rest) > 0 {
+		path, rest = rest[0], rest[1:]
+	}
+
+	var data []byte
+
+	if path == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(path)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	script := string(data)
+
+	if !strings.HasPrefix(script, "#!") {
+		return errors.New("the script must start with #!")
+	}
+
+	*desc = client.JobDesc{Keys: map[string]interface{}{}}
+	export = "NONE"
+
+	extra, err := parse_options(opts, directives(script))
+
+	if err != nil {
+		return err
+	}
+
+	if len(extra) > 0 {
+		return fmt.Errorf("invalid #SBATCH directive %q", extra[0])
+	}
+
+	if _, err := parse_options(opts, args); err != nil {
+		return err
+	}
+
+	desc.Script = script
+	desc.Environment = environment(export)
+
+	if path != "-" {
+		desc.Argv = append([]string{path}, rest...)
+	}
+
+	if desc.Name == "" {
+		desc.Name = "sbatch"
+		if path != "-" {
+			desc.Name = filepath.Base(path)
+		}
+	}
+
+	if desc.WorkDir == "" {
+		if desc.WorkDir, err = os.Getwd(); err != nil {
+			return err
+		}
+	}
+
+	res, err := c.SubmitBatchJob(ctx, desc)
+
+	if err != nil {
+		return err
+	}
+
+	if res.JobSubmitUserMsg != "" {
+		fmt.Fprintln(os.Stderr, res.JobSubmitUserMsg)
+	}
+
+	if parsable {
+		fmt.Println(res.JobId)
+	} else {
+		fmt.Println("Submitted batch job", res.JobId)
+	}
+
+	return nil
+}
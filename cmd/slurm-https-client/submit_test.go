@@ -0,0 +1,150 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/angt/slurm-https/client"
+)
+
+var directive_tests = []struct {
+	script string
+	args   []string
+}{
+	{"#!/bin/sh\n#SBATCH -N 2 -t 10\n", []string{"-N", "2", "-t", "10"}},
+	{"#!/bin/sh\n#SBATCH --job-name=\"my job\"\n", []string{"--job-name=my job"}},
+	{"#!/bin/sh\n#SBATCH --comment 'a \"b\" c'\n", []string{"--comment", `a "b" c`}},
+	{"#!/bin/sh\n#SBATCH -J a#b # a comment\n", []string{"-J", "a#b"}},
+	{"#!/bin/sh\n#SBATCH --comment=\"# not a comment\"\n", []string{"--comment=# not a comment"}},
+	{"#!/bin/sh\n\n# text\n#SBATCH -p debug\n", []string{"-p", "debug"}},
+	{"#!/bin/sh\n#SBATCH -p debug\necho\n#SBATCH -N 2\n", []string{"-p", "debug"}},
+	{"#!/bin/sh\n#SBATCH\n", nil},
+}
+
+func TestDirectives(t *testing.T) {
+	for _, test := range directive_tests {
+		if args := directives(test.script); !reflect.DeepEqual(args, test.args) {
+			t.Errorf("%q: %q, expected %q", test.script, args, test.args)
+		}
+	}
+}
+
+var option_tests = []struct {
+	args []string
+	desc client.JobDesc
+	rest []string
+}{
+	{[]string{"-J", "test", "-pdebug", "--account=acct"},
+		client.JobDesc{Name: "test", Partition: "debug", Account: "acct"}, nil},
+	{[]string{"-N", "2-4", "-n", "8", "-c2"},
+		client.JobDesc{MinNodes: client.Uint(2), MaxNodes: client.Uint(4), NumTasks: client.Uint(8), CpusPerTask: client.Uint(2)}, nil},
+	{[]string{"-t", "1-02:03:04", "--time-min=90"},
+		client.JobDesc{TimeLimit: client.Uint(1564), TimeMin: client.Uint(90)}, nil},
+	{[]string{"--time=unlimited"},
+		client.JobDesc{TimeLimit: client.Unlimited}, nil},
+	{[]string{"--mem=2G", "--hold"},
+		client.JobDesc{PnMinMemory: client.Uint(2048), Priority: client.Uint(0)}, nil},
+	{[]string{"--mem-per-cpu=512"},
+		client.JobDesc{PnMinMemory: client.Uint(512 | 1<<63)}, nil},
+	{[]string{"--mail-type=BEGIN,end", "--no-requeue"},
+		client.JobDesc{MailType: client.Uint(3), Requeue: client.Uint(0)}, nil},
+	{[]string{"-J", "a", "job.sh", "x", "--", "-N", "1"},
+		client.JobDesc{Name: "a"}, []string{"job.sh", "x", "-N", "1"}},
+}
+
+func TestOptions(t *testing.T) {
+	for _, test := range option_tests {
+		desc := client.JobDesc{Keys: map[string]interface{}{}}
+		export := "NONE"
+
+		rest, err := parse_options(job_options(&desc, &export), test.args)
+
+		if err != nil {
+			t.Errorf("%q: %v", test.args, err)
+			continue
+		}
+
+		test.desc.Keys = desc.Keys
+
+		if !reflect.DeepEqual(desc, test.desc) || !reflect.DeepEqual(rest, test.rest) {
+			t.Errorf("%q: %+v %q, expected %+v %q", test.args, desc, rest, test.desc, test.rest)
+		}
+	}
+}
+
+func TestBadOptions(t *testing.T) {
+	for _, args := range [][]string{
+		{"--nodes=a"},
+		{"-t", "1:2:3:4"},
+		{"--mem=lots"},
+		{"--mail-type=SOMETIMES"},
+		{"--begin=now+1fortnight"},
+		{"--hold=yes"},
+		{"--unknown"},
+		{"-J"},
+	} {
+		desc := client.JobDesc{Keys: map[string]interface{}{}}
+		export := "NONE"
+
+		if _, err := parse_options(job_options(&desc, &export), args); err == nil {
+			t.Errorf("%q: no error", args)
+		}
+	}
+}
+
+func TestBegin(t *testing.T) {
+	for _, test := range []struct {
+		s string
+		d time.Duration
+	}{
+		{"now", 0},
+		{"now+60", time.Minute},
+		{"now+1hour", time.Hour},
+		{"now+2hours", 2 * time.Hour},
+		{"NOW+1day", 24 * time.Hour},
+		{"now+1week", 7 * 24 * time.Hour},
+	} {
+		before := time.Now()
+		b, err := parse_begin(test.s)
+
+		if err != nil {
+			t.Errorf("%s: %v", test.s, err)
+			continue
+		}
+
+		if d := b.Sub(before); d < test.d-time.Second || d > test.d+time.Second {
+			t.Errorf("%s: in %v, expected %v", test.s, d, test.d)
+		}
+	}
+
+	b, err := parse_begin("2030-01-02T03:04")
+
+	if err != nil || !b.Equal(time.Date(2030, 1, 2, 3, 4, 0, 0, time.Local)) {
+		t.Errorf("2030-01-02T03:04: %v %v", b, err)
+	}
+}
+
+func TestEnvironment(t *testing.T) {
+	t.Setenv("SLURM_HTTPS_TEST", "1")
+
+	for _, test := range []struct {
+		export string
+		env    []string
+	}{
+		{"NONE", []string{"SLURM_GET_USER_ENV=1", "SLURM_EXPORT_ENV=NONE"}},
+		{"NONE,A=b", []string{"SLURM_GET_USER_ENV=1", "A=b", "SLURM_EXPORT_ENV=NONE,A=b"}},
+		{"SLURM_HTTPS_TEST,UNSET_VARIABLE", []string{"SLURM_HTTPS_TEST=1", "SLURM_EXPORT_ENV=SLURM_HTTPS_TEST,UNSET_VARIABLE"}},
+	} {
+		if env := environment(test.export); !reflect.DeepEqual(env, test.env) {
+			t.Errorf("%s: %q, expected %q", test.export, env, test.env)
+		}
+	}
+
+	env := environment("ALL")
+
+	if !strings.Contains(strings.Join(env, "\n"), "SLURM_HTTPS_TEST=1") {
+		t.Errorf("ALL: no SLURM_HTTPS_TEST in %q", env)
+	}
+}
@@ -0,0 +1,461 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// config is the live settings of the server, a new one replaces
+// the whole of it on SIGHUP so that a request always sees one set.
+
+type config struct {
+	listen []string
+
+	cert        string
+	key         string
+	ca          string
+	min_version uint16
+	tls         *tls.Config
+
+	ident_source string
+	usermap      string
+	policy_file  string
+	strict       bool
+	ident        *identity_config
+	policy       *policy_config
+
+	max_body int64
+	rate     float64
+	burst    int
+
+	cache_ttl       time.Duration
+	metrics_ttl     time.Duration
+	events_interval time.Duration
+
+	disabled []string
+
+	log_file     string
+	log_requests bool
+}
+
+var live atomic.Value
+
+func get_config() *config {
+	return live.Load().(*config)
+}
+
+func as_string(v interface{}) (string, error) {
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	return "", errors.New("expected a string")
+}
+
+func as_bool(v interface{}) (bool, error) {
+	if b, ok := v.(bool); ok {
+		return b, nil
+	}
+	return false, errors.New("expected true or false")
+}
+
+func as_int(v interface{}) (int64, error) {
+	switch n := v.(type) {
+	case int64:
+		return n, nil
+	case int:
+		return int64(n), nil
+	}
+	return 0, errors.New("expected an integer")
+}
+
+func as_float(v interface{}) (float64, error) {
+	if f, ok := v.(float64); ok {
+		return f, nil
+	}
+	n, err := as_int(v)
+	if err != nil {
+		return 0, errors.New("expected a number")
+	}
+	return float64(n), nil
+}
+
+func as_duration(v interface{}) (time.Duration, error) {
+	switch d := v.(type) {
+	case time.Duration:
+		return d, nil
+	case string:
+		return time.ParseDuration(d)
+	}
+	return 0, errors.New("expected a duration like \"5s\"")
+}
+
+// as_list takes an array of strings, or a comma separated string.
+
+func as_list(v interface{}) ([]string, error) {
+	if s, ok := v.(string); ok {
+		return strings.Split(s, ","), nil
+	}
+
+	items, ok := v.([]interface{})
+
+	if !ok {
+		return nil, errors.New("expected an array of strings")
+	}
+
+	ret := []string{}
+
+	for _, item := range items {
+		s, ok := item.(string)
+		if !ok {
+			return nil, errors.New("expected an array of strings")
+		}
+		ret = append(ret, s)
+	}
+
+	return ret, nil
+}
+
+var tls_versions = map[string]uint16{
+	"":    0,
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// config_key is a key of the config file, the keys with a flag
+// take their default from it and the flag wins when it is given.
+
+type config_key struct {
+	key   string
+	flag  string
+	def   interface{}
+	usage string
+	set   func(c *config, v interface{}) error
+}
+
+var config_keys = []config_key{
+	{"listen", "addr", ":8443", "addresses to serve, separated by commas", func(c *config, v interface{}) (err error) {
+		c.listen, err = as_list(v)
+		return
+	}},
+	{"tls.cert", "cert", "server.crt", "certificate", func(c *config, v interface{}) (err error) {
+		c.cert, err = as_string(v)
+		return
+	}},
+	{"tls.key", "key", "server.key", "certificate key", func(c *config, v interface{}) (err error) {
+		c.key, err = as_string(v)
+		return
+	}},
+	{"tls.ca", "ca", "ca.crt", "ca certificate", func(c *config, v interface{}) (err error) {
+		c.ca, err = as_string(v)
+		return
+	}},
+	{"tls.min_version", "", "", "", func(c *config, v interface{}) error {
+		s, err := as_string(v)
+		if err != nil {
+			return err
+		}
+		ver, ok := tls_versions[s]
+		if !ok {
+			return errors.New("expected 1.0, 1.1, 1.2 or 1.3")
+		}
+		c.min_version = ver
+		return nil
+	}},
+	{"auth.ident", "ident", "cn", "client identity: cn, email or an OID of the subject", func(c *config, v interface{}) (err error) {
+		c.ident_source, err = as_string(v)
+		return
+	}},
+	{"auth.usermap", "usermap", "", "file mapping client identities to users", func(c *config, v interface{}) (err error) {
+		c.usermap, err = as_string(v)
+		return
+	}},
+	{"auth.policy", "policy", "", "file assigning roles to client identities", func(c *config, v interface{}) (err error) {
+		c.policy_file, err = as_string(v)
+		return
+	}},
+	{"auth.strict", "strict", false, "reject jobs with a mismatching UserId/GroupId", func(c *config, v interface{}) (err error) {
+		c.strict, err = as_bool(v)
+		return
+	}},
+	{"limits.max_body", "max-body", int64(1 << 20), "maximum size of a request body", func(c *config, v interface{}) (err error) {
+		c.max_body, err = as_int(v)
+		if err == nil && c.max_body <= 0 {
+			err = errors.New("expected a positive size")
+		}
+		return
+	}},
+	{"limits.rate", "", int64(0), "", func(c *config, v interface{}) (err error) {
+		c.rate, err = as_float(v)
+		if err == nil && c.rate < 0 {
+			err = errors.New("expected a positive rate")
+		}
+		return
+	}},
+	{"limits.burst", "", int64(0), "", func(c *config, v interface{}) error {
+		n, err := as_int(v)
+		if err == nil && n < 0 {
+			err = errors.New("expected a positive count")
+		}
+		c.burst = int(n)
+		return err
+	}},
+	{"cache.lists", "cache", 2 * time.Second, "time to share a loaded list of jobs, nodes, partitions, reservations or frontends (0 to disable)", func(c *config, v interface{}) (err error) {
+		c.cache_ttl, err = as_duration(v)
+		return
+	}},
+	{"cache.metrics", "metrics-cache", 15 * time.Second, "time to cache slurm metrics", func(c *config, v interface{}) (err error) {
+		c.metrics_ttl, err = as_duration(v)
+		return
+	}},
+	{"events.interval", "events-interval", 5 * time.Second, "time between two polls of the job events", func(c *config, v interface{}) (err error) {
+		c.events_interval, err = as_duration(v)
+		if err == nil && c.events_interval <= 0 {
+			err = errors.New("expected a positive duration")
+		}
+		return
+	}},
+	{"endpoints.disabled", "", []interface{}{}, "", func(c *config, v interface{}) (err error) {
+		c.disabled, err = as_list(v)
+		return
+	}},
+	{"log.file", "", "", "", func(c *config, v interface{}) (err error) {
+		c.log_file, err = as_string(v)
+		return
+	}},
+	{"log.requests", "", false, "", func(c *config, v interface{}) (err error) {
+		c.log_requests, err = as_bool(v)
+		return
+	}},
+}
+
+// config_flags adds the flags of the config keys.
+
+func config_flags() {
+	for _, k := range config_keys {
+		if k.flag == "" {
+			continue
+		}
+		switch def := k.def.(type) {
+		case string:
+			flag.String(k.flag, def, k.usage)
+		case bool:
+			flag.Bool(k.flag, def, k.usage)
+		case int64:
+			flag.Int64(k.flag, def, k.usage)
+		case time.Duration:
+			flag.Duration(k.flag, def, k.usage)
+		}
+	}
+}
+
+// load_config reads the config file, if any, over the defaults and
+// under the flags given on the command line, then checks and loads
+// the files it names.
+
+func load_config(path string) (*config, error) {
+	values := make(map[string]toml_value)
+
+	if path != "" {
+		var err error
+		if values, err = parse_toml(path); err != nil {
+			return nil, err
+		}
+	}
+
+	given := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { given[f.Name] = true })
+
+	c := &config{}
+
+	for _, k := range config_keys {
+		v, ok := values[k.key]
+		delete(values, k.key)
+
+		value := k.def
+		where := "default of " + k.key
+
+		switch {
+		case k.flag != "" && given[k.flag]:
+			value = flag.Lookup(k.flag).Value.(flag.Getter).Get()
+			where = "-" + k.flag
+		case ok:
+			value = v.value
+			where = fmt.Sprintf("%s:%d: %s", path, v.line, k.key)
+		case k.flag != "":
+			value = flag.Lookup(k.flag).Value.(flag.Getter).Get()
+		}
+
+		if err := k.set(c, value); err != nil {
+			return nil, fmt.Errorf("%s: %v", where, err)
+		}
+	}
+
+	for key, v := range values {
+		return nil, fmt.Errorf("%s:%d: unknown key %s", path, v.line, key)
+	}
+
+	return c, c.check()
+}
+
+// check validates the settings and loads the certificates,
+// the usermap and the policy.
+
+func (c *config) check() error {
+	if len(c.listen) == 0 {
+		return errors.New("no address to serve")
+	}
+
+	for _, path := range c.disabled {
+		if !has_route(path) {
+			return errors.New("unknown endpoint to disable: " + path)
+		}
+	}
+
+	pair, err := tls.LoadX509KeyPair(c.cert, c.key)
+
+	if err != nil {
+		return err
+	}
+
+	ca_cert, err := ioutil.ReadFile(c.ca)
+
+	if err != nil {
+		return err
+	}
+
+	ca_pool := x509.NewCertPool()
+
+	if !ca_pool.AppendCertsFromPEM(ca_cert) {
+		return errors.New("no certificate found in " + c.ca)
+	}
+
+	c.tls = &tls.Config{
+		Certificates: []tls.Certificate{pair},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    ca_pool,
+		MinVersion:   c.min_version,
+		NextProtos:   []string{"h2", "http/1.1"},
+	}
+
+	c.ident = &identity_config{strict: c.strict}
+
+	if err := c.ident.SetSource(c.ident_source); err != nil {
+		return err
+	}
+
+	if err := c.ident.Load(c.usermap); err != nil {
+		return err
+	}
+
+	c.policy = &policy_config{}
+
+	return c.policy.Load(c.policy_file)
+}
+
+// the servers by address, only used by main
+
+var servers = make(map[string]*http.Server)
+
+var log_output *os.File
+
+// apply_config makes c live: the new addresses are bound first, so that
+// nothing changes if one fails, then the servers of the addresses c
+// doesn't have anymore stop once their requests are done.
+
+func apply_config(c *config, handler http.Handler) error {
+	listeners := make(map[string]net.Listener)
+	keep := make(map[string]bool)
+
+	fail := func(err error) error {
+		for _, ln := range listeners {
+			ln.Close()
+		}
+		return err
+	}
+
+	for _, addr := range c.listen {
+		keep[addr] = true
+
+		if _, ok := servers[addr]; ok || listeners[addr] != nil {
+			continue
+		}
+
+		ln, err := net.Listen("tcp", addr)
+
+		if err != nil {
+			return fail(err)
+		}
+
+		listeners[addr] = ln
+	}
+
+	var file *os.File
+
+	if c.log_file != "" {
+		var err error
+		file, err = os.OpenFile(c.log_file, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+		if err != nil {
+			return fail(err)
+		}
+	}
+
+	live.Store(c)
+
+	if file != nil {
+		log.SetOutput(file)
+	} else {
+		log.SetOutput(os.Stderr)
+	}
+
+	if log_output != nil {
+		log_output.Close()
+	}
+
+	log_output = file
+
+	for addr, ln := range listeners {
+		server := &http.Server{
+			Addr:    addr,
+			Handler: handler,
+			TLSConfig: &tls.Config{
+				GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+					return get_config().tls, nil
+				},
+			},
+		}
+
+		servers[addr] = server
+
+		go func(server *http.Server, ln net.Listener) {
+			if err := server.ServeTLS(ln, "", ""); err != http.ErrServerClosed {
+				log.Fatal(err)
+			}
+		}(server, ln)
+
+		log.Println("Listening on", addr)
+	}
+
+	for addr, server := range servers {
+		if !keep[addr] {
+			delete(servers, addr)
+			go server.Shutdown(context.Background())
+			log.Println("Stopped listening on", addr)
+		}
+	}
+
+	return nil
+}
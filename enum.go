@@ -0,0 +1,244 @@
+package main
+
+/*
+#include "slurm/slurm.h"
+*/
+import "C"
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+type enum_value struct {
+	name  string
+	value uint64
+}
+
+// enum gives the symbolic names of an integer key,
+// the names of flags are combined with commas or +.
+
+type enum struct {
+	values []enum_value
+	flags  bool
+}
+
+func (e *enum) Parse(s string) (uint64, error) {
+	if v, err := strconv.ParseUint(s, 0, 64); err == nil {
+		return v, nil
+	}
+
+	var ret uint64
+
+	for _, name := range strings.FieldsFunc(s, func(c rune) bool {
+		return e.flags && (c == ',' || c == '+')
+	}) {
+		found := false
+		for _, v := range e.values {
+			if strings.EqualFold(v.name, strings.TrimSpace(name)) {
+				ret |= v.value
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, errors.New("Unknown name " + name)
+		}
+	}
+
+	return ret, nil
+}
+
+func (e *enum) Names(value uint64) []string {
+	ret := make([]string, 0)
+
+	for _, v := range e.values {
+		if v.value != 0 && value&v.value == v.value {
+			ret = append(ret, v.name)
+		}
+	}
+
+	return ret
+}
+
+var show_flags_enum = &enum{flags: true, values: []enum_value{
+	{"ALL", C.SHOW_ALL},
+	{"DETAIL", C.SHOW_DETAIL},
+	{"MIXED", C.SHOW_MIXED},
+	{"LOCAL", C.SHOW_LOCAL},
+	{"SIBLING", C.SHOW_SIBLING},
+	{"FEDERATION", C.SHOW_FEDERATION},
+	{"FUTURE", C.SHOW_FUTURE},
+}}
+
+var node_flags_enum = &enum{flags: true, values: []enum_value{
+	{"NET", C.NODE_STATE_NET},
+	{"RES", C.NODE_STATE_RES},
+	{"UNDRAIN", C.NODE_STATE_UNDRAIN},
+	{"CLOUD", C.NODE_STATE_CLOUD},
+	{"RESUME", C.NODE_RESUME},
+	{"DRAIN", C.NODE_STATE_DRAIN},
+	{"COMPLETING", C.NODE_STATE_COMPLETING},
+	{"NO_RESPOND", C.NODE_STATE_NO_RESPOND},
+	{"POWER_SAVE", C.NODE_STATE_POWER_SAVE},
+	{"FAIL", C.NODE_STATE_FAIL},
+	{"POWER_UP", C.NODE_STATE_POWER_UP},
+	{"MAINT", C.NODE_STATE_MAINT},
+	{"REBOOT", C.NODE_STATE_REBOOT},
+	{"POWERING_DOWN", C.NODE_STATE_POWERING_DOWN},
+}}
+
+var node_state_enum = &enum{flags: true, values: append([]enum_value{
+	{"UNKNOWN", C.NODE_STATE_UNKNOWN},
+	{"DOWN", C.NODE_STATE_DOWN},
+	{"IDLE", C.NODE_STATE_IDLE},
+	{"ALLOCATED", C.NODE_STATE_ALLOCATED},
+	{"ERROR", C.NODE_STATE_ERROR},
+	{"MIXED", C.NODE_STATE_MIXED},
+	{"FUTURE", C.NODE_STATE_FUTURE},
+}, node_flags_enum.values...)}
+
+var part_state_enum = &enum{values: []enum_value{
+	{"UP", C.PARTITION_UP},
+	{"DOWN", C.PARTITION_DOWN},
+	{"DRAIN", C.PARTITION_DRAIN},
+	{"INACTIVE", C.PARTITION_INACTIVE},
+}}
+
+var part_flags_enum = &enum{flags: true, values: []enum_value{
+	{"DEFAULT", C.PART_FLAG_DEFAULT},
+	{"HIDDEN", C.PART_FLAG_HIDDEN},
+	{"NO_ROOT", C.PART_FLAG_NO_ROOT},
+	{"ROOT_ONLY", C.PART_FLAG_ROOT_ONLY},
+	{"REQ_RESV", C.PART_FLAG_REQ_RESV},
+	{"LLN", C.PART_FLAG_LLN},
+	{"EXCLUSIVE_USER", C.PART_FLAG_EXCLUSIVE_USER},
+}}
+
+var resv_flags_enum = &enum{flags: true, values: []enum_value{
+	{"MAINT", C.RESERVE_FLAG_MAINT},
+	{"NO_MAINT", C.RESERVE_FLAG_NO_MAINT},
+	{"DAILY", C.RESERVE_FLAG_DAILY},
+	{"NO_DAILY", C.RESERVE_FLAG_NO_DAILY},
+	{"WEEKLY", C.RESERVE_FLAG_WEEKLY},
+	{"NO_WEEKLY", C.RESERVE_FLAG_NO_WEEKLY},
+	{"IGNORE_JOBS", C.RESERVE_FLAG_IGN_JOBS},
+	{"NO_IGNORE_JOBS", C.RESERVE_FLAG_NO_IGN_JOB},
+	{"ANY_NODES", C.RESERVE_FLAG_ANY_NODES},
+	{"NO_ANY_NODES", C.RESERVE_FLAG_NO_ANY_NODES},
+	{"STATIC", C.RESERVE_FLAG_STATIC},
+	{"NO_STATIC", C.RESERVE_FLAG_NO_STATIC},
+	{"PART_NODES", C.RESERVE_FLAG_PART_NODES},
+	{"NO_PART_NODES", C.RESERVE_FLAG_NO_PART_NODES},
+	{"OVERLAP", C.RESERVE_FLAG_OVERLAP},
+	{"SPEC_NODES", C.RESERVE_FLAG_SPEC_NODES},
+	{"FIRST_CORES", C.RESERVE_FLAG_FIRST_CORES},
+	{"TIME_FLOAT", C.RESERVE_FLAG_TIME_FLOAT},
+	{"REPLACE", C.RESERVE_FLAG_REPLACE},
+	{"ALL_NODES", C.RESERVE_FLAG_ALL_NODES},
+	{"PURGE_COMP", C.RESERVE_FLAG_PURGE_COMP},
+	{"WEEKDAY", C.RESERVE_FLAG_WEEKDAY},
+	{"NO_WEEKDAY", C.RESERVE_FLAG_NO_WEEKDAY},
+	{"WEEKEND", C.RESERVE_FLAG_WEEKEND},
+	{"NO_WEEKEND", C.RESERVE_FLAG_NO_WEEKEND},
+	{"REPLACE_DOWN", C.RESERVE_FLAG_REPLACE_DOWN},
+}}
+
+// keys of a request accepting symbolic names, by struct
+
+var enum_keys = map[reflect.Type]map[string]*enum{
+	reflect.TypeOf(C.update_node_msg_t{}): {
+		"NodeState": node_state_enum,
+	},
+	reflect.TypeOf(C.update_part_msg_t{}): {
+		"StateUp": part_state_enum,
+		"Flags":   part_flags_enum,
+	},
+	reflect.TypeOf(C.resv_desc_msg_t{}): {
+		"Flags": resv_flags_enum,
+	},
+}
+
+// keys accepting symbolic names in any struct
+
+var enum_any = map[string]*enum{
+	"ShowFlags": show_flags_enum,
+}
+
+func get_enum(t reflect.Type, key string) *enum {
+	if e, ok := enum_keys[t][key]; ok {
+		return e
+	}
+	return enum_any[key]
+}
+
+func add_job_names(t table) {
+	if v, ok := t["JobState"].(uint); ok {
+		t["JobStateName"] = C.GoString(C.slurm_job_state_string(C.uint32_t(v)))
+	}
+	if v, ok := t["StateReason"].(uint); ok {
+		t["StateReasonName"] = C.GoString(C.slurm_job_reason_string(C.enum_job_state_reason(v)))
+	}
+}
+
+func add_node_names(t table) {
+	if v, ok := t["NodeState"].(uint); ok {
+		t["NodeStateName"] = C.GoString(C.slurm_node_state_string(C.uint32_t(v & C.NODE_STATE_BASE)))
+		t["NodeStateFlags"] = node_flags_enum.Names(uint64(v & C.NODE_STATE_FLAGS))
+	}
+}
+
+func add_partition_names(t table) {
+	if v, ok := t["StateUp"].(uint); ok {
+		for _, s := range part_state_enum.values {
+			if uint64(v) == s.value {
+				t["StateUpName"] = s.name
+			}
+		}
+	}
+	if v, ok := t["Flags"].(uint); ok {
+		t["FlagNames"] = part_flags_enum.Names(uint64(v))
+	}
+}
+
+func add_reservation_names(t table) {
+	if v, ok := t["Flags"].(uint); ok {
+		t["FlagNames"] = resv_flags_enum.Names(uint64(v))
+	}
+}
+
+// names added to the records of a list, by list key
+
+var list_names = map[string]func(table){
+	"JobArray":         add_job_names,
+	"NodeArray":        add_node_names,
+	"FrontEndArray":    add_node_names,
+	"PartitionArray":   add_partition_names,
+	"ReservationArray": add_reservation_names,
+}
+
+// parse_enum replaces a name, or a list of names, by its value
+
+func parse_enum(e *enum, value json.RawMessage) (json.RawMessage, error) {
+	var s string
+	var names []string
+
+	switch {
+	case json.Unmarshal(value, &s) == nil:
+	case json.Unmarshal(value, &names) == nil && e.flags:
+		s = strings.Join(names, ",")
+	default:
+		return value, nil
+	}
+
+	v, err := e.Parse(s)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return json.RawMessage(strconv.FormatUint(v, 10)), nil
+}
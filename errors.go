@@ -0,0 +1,129 @@
+package main
+
+/*
+#include <errno.h>
+
+#include "slurm/slurm_errno.h"
+*/
+import "C"
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+type api_error struct {
+	Status  int
+	Errno   int    `json:",omitempty"`
+	Name    string `json:",omitempty"`
+	Message string
+	Key     string `json:",omitempty"`
+}
+
+func http_error(w http.ResponseWriter, status int, msg string, key string) {
+	send_error(w, &api_error{
+		Status:  status,
+		Message: msg,
+		Key:     key,
+	})
+}
+
+func send_error(w http.ResponseWriter, e *api_error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(e.Status)
+	json.NewEncoder(w).Encode(e)
+}
+
+type errno_info struct {
+	name   string
+	status int
+}
+
+var errno_table = map[C.int]errno_info{
+	C.SLURM_ERROR: {"SLURM_ERROR", 500},
+
+	C.SLURM_COMMUNICATIONS_CONNECTION_ERROR:     {"SLURM_COMMUNICATIONS_CONNECTION_ERROR", 503},
+	C.SLURM_COMMUNICATIONS_SEND_ERROR:           {"SLURM_COMMUNICATIONS_SEND_ERROR", 503},
+	C.SLURM_COMMUNICATIONS_RECEIVE_ERROR:        {"SLURM_COMMUNICATIONS_RECEIVE_ERROR", 503},
+	C.SLURM_COMMUNICATIONS_SHUTDOWN_ERROR:       {"SLURM_COMMUNICATIONS_SHUTDOWN_ERROR", 503},
+	C.SLURMCTLD_COMMUNICATIONS_CONNECTION_ERROR: {"SLURMCTLD_COMMUNICATIONS_CONNECTION_ERROR", 503},
+	C.SLURMCTLD_COMMUNICATIONS_SEND_ERROR:       {"SLURMCTLD_COMMUNICATIONS_SEND_ERROR", 503},
+	C.SLURMCTLD_COMMUNICATIONS_RECEIVE_ERROR:    {"SLURMCTLD_COMMUNICATIONS_RECEIVE_ERROR", 503},
+	C.SLURMCTLD_COMMUNICATIONS_SHUTDOWN_ERROR:   {"SLURMCTLD_COMMUNICATIONS_SHUTDOWN_ERROR", 503},
+	C.SLURM_PROTOCOL_SOCKET_IMPL_TIMEOUT:        {"SLURM_PROTOCOL_SOCKET_IMPL_TIMEOUT", 503},
+	C.SLURM_PROTOCOL_SOCKET_ZERO_BYTES_SENT:     {"SLURM_PROTOCOL_SOCKET_ZERO_BYTES_SENT", 503},
+	C.ESLURM_IN_STANDBY_MODE:                    {"ESLURM_IN_STANDBY_MODE", 503},
+
+	C.ESLURM_INVALID_JOB_ID:         {"ESLURM_INVALID_JOB_ID", 404},
+	C.ESLURM_INVALID_NODE_NAME:      {"ESLURM_INVALID_NODE_NAME", 404},
+	C.ESLURM_INVALID_PARTITION_NAME: {"ESLURM_INVALID_PARTITION_NAME", 404},
+	C.ESLURM_RESERVATION_INVALID:    {"ESLURM_RESERVATION_INVALID", 404},
+	C.ESRCH:                         {"ESRCH", 404},
+	C.ENOENT:                        {"ENOENT", 404},
+
+	C.ESLURM_ACCESS_DENIED:           {"ESLURM_ACCESS_DENIED", 403},
+	C.ESLURM_USER_ID_MISSING:         {"ESLURM_USER_ID_MISSING", 403},
+	C.ESLURM_RESERVATION_ACCESS:      {"ESLURM_RESERVATION_ACCESS", 403},
+	C.ESLURM_BURST_BUFFER_PERMISSION: {"ESLURM_BURST_BUFFER_PERMISSION", 403},
+
+	C.ESLURM_ALREADY_DONE:                {"ESLURM_ALREADY_DONE", 409},
+	C.ESLURM_TRANSITION_STATE_NO_UPDATE:  {"ESLURM_TRANSITION_STATE_NO_UPDATE", 409},
+	C.ESLURM_DUPLICATE_JOB_ID:            {"ESLURM_DUPLICATE_JOB_ID", 409},
+	C.ESLURM_NODES_BUSY:                  {"ESLURM_NODES_BUSY", 409},
+	C.ESLURM_JOB_PENDING:                 {"ESLURM_JOB_PENDING", 409},
+	C.ESLURM_JOB_HELD:                    {"ESLURM_JOB_HELD", 409},
+	C.ESLURM_JOB_SUSPENDED:               {"ESLURM_JOB_SUSPENDED", 409},
+	C.ESLURM_JOB_STARTED:                 {"ESLURM_JOB_STARTED", 409},
+	C.ESLURM_JOB_FINISHED:                {"ESLURM_JOB_FINISHED", 409},
+	C.ESLURM_JOB_NOT_RUNNING:             {"ESLURM_JOB_NOT_RUNNING", 409},
+	C.ESLURM_JOB_NOT_PENDING:             {"ESLURM_JOB_NOT_PENDING", 409},
+	C.ESLURM_JOB_NOT_PENDING_NOR_RUNNING: {"ESLURM_JOB_NOT_PENDING_NOR_RUNNING", 409},
+	C.ESLURM_JOB_NOT_SUSPENDED:           {"ESLURM_JOB_NOT_SUSPENDED", 409},
+	C.ESLURM_JOB_NOT_FINISHED:            {"ESLURM_JOB_NOT_FINISHED", 409},
+	C.ESLURM_RESERVATION_BUSY:            {"ESLURM_RESERVATION_BUSY", 409},
+	C.ESLURM_RESERVATION_OVERLAP:         {"ESLURM_RESERVATION_OVERLAP", 409},
+	C.ESLURM_RESERVATION_NAME_DUP:        {"ESLURM_RESERVATION_NAME_DUP", 409},
+	C.ESLURM_PARTITION_IN_USE:            {"ESLURM_PARTITION_IN_USE", 409},
+	C.ESLURM_TRIGGER_DUP:                 {"ESLURM_TRIGGER_DUP", 409},
+
+	C.ESLURM_DEFAULT_PARTITION_NOT_SET:         {"ESLURM_DEFAULT_PARTITION_NOT_SET", 400},
+	C.ESLURM_REQUESTED_NODES_NOT_IN_PARTITION:  {"ESLURM_REQUESTED_NODES_NOT_IN_PARTITION", 400},
+	C.ESLURM_TOO_MANY_REQUESTED_CPUS:           {"ESLURM_TOO_MANY_REQUESTED_CPUS", 400},
+	C.ESLURM_INVALID_NODE_COUNT:                {"ESLURM_INVALID_NODE_COUNT", 400},
+	C.ESLURM_JOB_MISSING_SIZE_SPECIFICATION:    {"ESLURM_JOB_MISSING_SIZE_SPECIFICATION", 400},
+	C.ESLURM_JOB_SCRIPT_MISSING:                {"ESLURM_JOB_SCRIPT_MISSING", 400},
+	C.ESLURM_PATHNAME_TOO_LONG:                 {"ESLURM_PATHNAME_TOO_LONG", 400},
+	C.ESLURM_REQUESTED_NODE_CONFIG_UNAVAILABLE: {"ESLURM_REQUESTED_NODE_CONFIG_UNAVAILABLE", 400},
+	C.ESLURM_REQUESTED_PART_CONFIG_UNAVAILABLE: {"ESLURM_REQUESTED_PART_CONFIG_UNAVAILABLE", 400},
+	C.ESLURM_BAD_DIST:                          {"ESLURM_BAD_DIST", 400},
+	C.ESLURM_BAD_TASK_COUNT:                    {"ESLURM_BAD_TASK_COUNT", 400},
+	C.ESLURM_INVALID_NODE_STATE:                {"ESLURM_INVALID_NODE_STATE", 400},
+	C.ESLURM_INVALID_FEATURE:                   {"ESLURM_INVALID_FEATURE", 400},
+	C.ESLURM_NOT_SUPPORTED:                     {"ESLURM_NOT_SUPPORTED", 400},
+	C.ESLURM_DEPENDENCY:                        {"ESLURM_DEPENDENCY", 400},
+	C.ESLURM_CIRCULAR_DEPENDENCY:               {"ESLURM_CIRCULAR_DEPENDENCY", 400},
+	C.ESLURM_BATCH_ONLY:                        {"ESLURM_BATCH_ONLY", 400},
+	C.ESLURM_INVALID_TASK_MEMORY:               {"ESLURM_INVALID_TASK_MEMORY", 400},
+	C.ESLURM_INVALID_ACCOUNT:                   {"ESLURM_INVALID_ACCOUNT", 400},
+	C.ESLURM_INVALID_LICENSES:                  {"ESLURM_INVALID_LICENSES", 400},
+	C.ESLURM_INVALID_TIME_LIMIT:                {"ESLURM_INVALID_TIME_LIMIT", 400},
+	C.ESLURM_INVALID_TIME_VALUE:                {"ESLURM_INVALID_TIME_VALUE", 400},
+	C.ESLURM_INVALID_WCKEY:                     {"ESLURM_INVALID_WCKEY", 400},
+	C.ESLURM_INVALID_QOS:                       {"ESLURM_INVALID_QOS", 400},
+	C.ESLURM_INVALID_CPU_COUNT:                 {"ESLURM_INVALID_CPU_COUNT", 400},
+	C.ESLURM_INVALID_GRES:                      {"ESLURM_INVALID_GRES", 400},
+	C.ESLURM_INVALID_ARRAY:                     {"ESLURM_INVALID_ARRAY", 400},
+	C.ESLURM_ACCOUNTING_POLICY:                 {"ESLURM_ACCOUNTING_POLICY", 400},
+	C.ESLURM_PARTITION_NOT_AVAIL:               {"ESLURM_PARTITION_NOT_AVAIL", 400},
+	C.ESLURM_NODE_NOT_AVAIL:                    {"ESLURM_NODE_NOT_AVAIL", 400},
+	C.ESLURM_CAN_NOT_START_IMMEDIATELY:         {"ESLURM_CAN_NOT_START_IMMEDIATELY", 400},
+}
+
+func get_errno_info(errno C.int) errno_info {
+	if info, ok := errno_table[errno]; ok {
+		return info
+	}
+
+	return errno_info{"", 500}
+}
@@ -0,0 +1,371 @@
+package main
+
+/*
+#include "slurm/slurm.h"
+#include "slurm/slurm_errno.h"
+*/
+import "C"
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+type job_event struct {
+	Id            uint64 `json:"-"`
+	Type          string
+	Time          int64
+	JobId         uint32
+	JobState      uint32
+	PreviousState uint32 `json:",omitempty"`
+	UserId        uint32
+	Partition     string
+	Name          string
+}
+
+type job_filter struct {
+	users      map[uint32]bool
+	partitions map[string]bool
+	jobs       map[uint32]bool
+}
+
+func (f *job_filter) Match(e *job_event) bool {
+	if f.users != nil && !f.users[e.UserId] {
+		return false
+	}
+
+	if f.partitions != nil && !f.partitions[e.Partition] {
+		return false
+	}
+
+	if f.jobs != nil && !f.jobs[e.JobId] {
+		return false
+	}
+
+	return true
+}
+
+// get_job_filter reads the comma separated lists user, partition
+// and job_id of the query string.
+
+func get_job_filter(r *http.Request) (*job_filter, string, error) {
+	f := &job_filter{}
+	query := r.URL.Query()
+
+	if s := query.Get("user"); s != "" {
+		f.users = make(map[uint32]bool)
+		for _, name := range strings.Split(s, ",") {
+			id, err := lookup_user(name)
+			if err != nil {
+				return nil, "user", err
+			}
+			f.users[id.Uid] = true
+		}
+	}
+
+	if s := query.Get("partition"); s != "" {
+		f.partitions = make(map[string]bool)
+		for _, name := range strings.Split(s, ",") {
+			f.partitions[name] = true
+		}
+	}
+
+	if s := query.Get("job_id"); s != "" {
+		f.jobs = make(map[uint32]bool)
+		for _, v := range strings.Split(s, ",") {
+			id, err := strconv.ParseUint(v, 10, 32)
+			if err != nil {
+				return nil, "job_id", err
+			}
+			f.jobs[uint32(id)] = true
+		}
+	}
+
+	return f, "", nil
+}
+
+type job_subscriber struct {
+	ch     chan *job_event
+	filter *job_filter
+}
+
+const events_history = 1024
+
+var events = struct {
+	sync.Mutex
+	subscribers map[*job_subscriber]bool
+	history     []*job_event
+	seq         uint64
+	running     bool
+}{
+	subscribers: make(map[*job_subscriber]bool),
+}
+
+// subscribe replays the events after last_id before any new one,
+// the poller is started with the first subscriber.
+
+func subscribe(filter *job_filter, last_id uint64) *job_subscriber {
+	events.Lock()
+	defer events.Unlock()
+
+	sub := &job_subscriber{
+		ch:     make(chan *job_event, events_history+256),
+		filter: filter,
+	}
+
+	if last_id > 0 {
+		for _, e := range events.history {
+			if e.Id > last_id && filter.Match(e) {
+				sub.ch <- e
+			}
+		}
+	}
+
+	events.subscribers[sub] = true
+
+	if !events.running {
+		events.running = true
+		go poll_jobs()
+	}
+
+	return sub
+}
+
+func unsubscribe(sub *job_subscriber) {
+	events.Lock()
+	defer events.Unlock()
+
+	if events.subscribers[sub] {
+		delete(events.subscribers, sub)
+		close(sub.ch)
+	}
+}
+
+func publish(e *job_event) {
+	events.Lock()
+	defer events.Unlock()
+
+	events.seq++
+	e.Id = events.seq
+
+	events.history = append(events.history, e)
+
+	if len(events.history) > events_history {
+		events.history = events.history[len(events.history)-events_history:]
+	}
+
+	for sub := range events.subscribers {
+		if !sub.filter.Match(e) {
+			continue
+		}
+		select {
+		case sub.ch <- e:
+		default:
+			// too slow, the client will resume with Last-Event-ID
+			delete(events.subscribers, sub)
+			close(sub.ch)
+		}
+	}
+}
+
+func job_finished(state C.uint32_t) bool {
+	return state&C.JOB_STATE_BASE >= C.JOB_COMPLETE
+}
+
+// poll_jobs loads the jobs changed since the last poll and publishes
+// the differences, it stops when nobody is listening anymore.
+
+func poll_jobs() {
+	var last_update C.time_t
+
+	jobs := make(map[uint32]*job_event)
+	first := true
+
+	for {
+		events.Lock()
+		if len(events.subscribers) == 0 {
+			events.running = false
+			events.Unlock()
+			return
+		}
+		interval := get_config().events_interval
+		events.Unlock()
+
+		slres, errno := backend.LoadJobs(last_update, C.SHOW_ALL)
+
+		if errno != 0 {
+			if errno != C.SLURM_NO_CHANGE_IN_DATA {
+				count_errno(errno)
+				log.Println("events:", C.GoString(C.slurm_strerror(errno)))
+			}
+			time.Sleep(interval)
+			continue
+		}
+
+		last_update = slres.last_update
+		now := time.Now().Unix()
+
+		count := int(slres.record_count)
+		carray := *(*[]C.job_info_t)(unsafe.Pointer(&reflect.SliceHeader{
+			Data: uintptr(unsafe.Pointer(slres.job_array)),
+			Len:  count,
+			Cap:  count,
+		}))
+
+		seen := make(map[uint32]*job_event, count)
+
+		for i := 0; i < count; i++ {
+			job := &carray[i]
+			prev, ok := jobs[uint32(job.job_id)]
+
+			if ok && prev.JobState == uint32(job.job_state) {
+				seen[prev.JobId] = prev
+				continue
+			}
+
+			e := &job_event{
+				Type:      "created",
+				Time:      now,
+				JobId:     uint32(job.job_id),
+				JobState:  uint32(job.job_state),
+				UserId:    uint32(job.user_id),
+				Partition: C.GoString(job.partition),
+				Name:      C.GoString(job.name),
+			}
+
+			seen[e.JobId] = e
+
+			if first {
+				continue
+			}
+
+			if ok {
+				e.Type = "state-changed"
+				e.PreviousState = prev.JobState
+				if job_finished(job.job_state) && !job_finished(C.uint32_t(prev.JobState)) {
+					e.Type = "finished"
+				}
+			}
+
+			publish(e)
+		}
+
+		backend.Free(slres)
+
+		// the jobs gone from the snapshot were purged by slurmctld,
+		// with or without an end that was seen
+
+		for id, prev := range jobs {
+			if seen[id] == nil {
+				publish(&job_event{
+					Type:      "purged",
+					Time:      now,
+					JobId:     id,
+					JobState:  prev.JobState,
+					UserId:    prev.UserId,
+					Partition: prev.Partition,
+					Name:      prev.Name,
+				})
+			}
+		}
+
+		jobs = seen
+		first = false
+
+		time.Sleep(interval)
+	}
+}
+
+func job_events(w http.ResponseWriter, r *http.Request) {
+	filter, key, err := get_job_filter(r)
+
+	if err != nil {
+		http_error(w, 400, "Bad value", key)
+		return
+	}
+
+	var last_id uint64
+
+	if s := r.Header.Get("Last-Event-ID"); s != "" {
+		last_id, _ = strconv.ParseUint(s, 10, 64)
+	}
+
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		job_events_ws(w, r, filter, last_id)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+
+	if !ok {
+		http_error(w, 500, "Streaming not supported", "")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(200)
+	flusher.Flush()
+
+	sub := subscribe(filter, last_id)
+	defer unsubscribe(sub)
+
+	keepalive := time.NewTicker(30 * time.Second)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case e, ok := <-sub.ch:
+			if !ok {
+				return
+			}
+			data, _ := json.Marshal(e)
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.Id, e.Type, data)
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+func job_events_ws(w http.ResponseWriter, r *http.Request, filter *job_filter, last_id uint64) {
+	ws, err := ws_upgrade(w, r)
+
+	if err != nil {
+		http_error(w, 400, err.Error(), "")
+		return
+	}
+
+	defer ws.Close()
+
+	sub := subscribe(filter, last_id)
+	defer unsubscribe(sub)
+
+	for {
+		select {
+		case e, ok := <-sub.ch:
+			if !ok {
+				return
+			}
+			data, _ := json.Marshal(struct {
+				Id uint64
+				*job_event
+			}{e.Id, e})
+			if ws.WriteText(data) != nil {
+				return
+			}
+		case <-ws.closed:
+			return
+		}
+	}
+}
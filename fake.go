@@ -0,0 +1,1723 @@
+package main
+
+/*
+#include <errno.h>
+#include <signal.h>
+#include <stdlib.h>
+
+#include "slurm/slurm.h"
+#include "slurm/slurm_errno.h"
+*/
+import "C"
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// fake_cluster is a small cluster kept in memory that answers like
+// slurmctld, to serve the api without slurmctld. Nothing happens on its
+// own: jobs only start, end or move when a request asks for it, so
+// the same requests always give the same ids and states.
+
+type fake_job struct {
+	id          uint32
+	user_id     uint32
+	group_id    uint32
+	name        string
+	partition   string
+	work_dir    string
+	std_out     string
+	std_err     string
+	comment     string
+	batch       bool
+	state       uint32
+	reason      uint16
+	priority    uint32
+	min_nodes   uint32
+	num_cpus    uint32
+	time_limit  uint32
+	exit_code   uint32
+	nodes       []*fake_node
+	step        bool
+	submit_time int64
+	start_time  int64
+	end_time    int64
+}
+
+type fake_node struct {
+	name        string
+	cpus        uint16
+	memory      uint64
+	state       uint32
+	reason      string
+	reason_time int64
+	reason_uid  uint32
+}
+
+type fake_partition struct {
+	name         string
+	nodes        []*fake_node
+	state_up     uint16
+	flags        uint16
+	max_time     uint32
+	max_nodes    uint32
+	default_time uint32
+}
+
+type fake_reservation struct {
+	name       string
+	nodes      []*fake_node
+	partition  string
+	users      string
+	accounts   string
+	flags      uint32
+	start_time int64
+	end_time   int64
+}
+
+type fake_trigger struct {
+	id        uint32
+	flags     uint16
+	res_type  uint16
+	res_id    string
+	trig_type uint32
+	offset    uint16
+	user_id   uint32
+	program   string
+}
+
+type fake_cluster struct {
+	sync.Mutex
+	start        int64
+	job_update   int64
+	node_update  int64
+	part_update  int64
+	resv_update  int64
+	next_job     uint32
+	next_resv    int
+	next_trigger uint32
+	jobs         []*fake_job
+	nodes        []*fake_node
+	partitions   []*fake_partition
+	reservations []*fake_reservation
+	triggers     []*fake_trigger
+	stats        struct {
+		start     int64
+		submitted uint32
+		started   uint32
+		completed uint32
+		canceled  uint32
+		failed    uint32
+	}
+	msgs map[interface{}]*arena
+
+	// the calls that would stop or move slurmctld, only recorded
+
+	shutdowns []C.uint16_t
+	takeovers []C.int
+}
+
+const fake_cpus = 4
+const fake_memory = 8192
+
+// new_fake_cluster returns a cluster of count nodes,
+// node1 to nodeN, all in the default partition debug.
+
+func new_fake_cluster(count int) *fake_cluster {
+	now := time.Now().Unix()
+
+	f := &fake_cluster{
+		start:        now,
+		job_update:   now,
+		node_update:  now,
+		part_update:  now,
+		resv_update:  now,
+		next_job:     1,
+		next_resv:    1,
+		next_trigger: 1,
+		msgs:         make(map[interface{}]*arena),
+	}
+
+	f.stats.start = now
+
+	for i := 1; i <= count; i++ {
+		f.nodes = append(f.nodes, &fake_node{
+			name:   "node" + strconv.Itoa(i),
+			cpus:   fake_cpus,
+			memory: fake_memory,
+			state:  C.NODE_STATE_IDLE,
+		})
+	}
+
+	f.partitions = append(f.partitions, &fake_partition{
+		name:         "debug",
+		nodes:        f.nodes,
+		state_up:     C.PARTITION_UP,
+		flags:        C.PART_FLAG_DEFAULT,
+		max_time:     C.INFINITE,
+		max_nodes:    C.INFINITE,
+		default_time: C.NO_VAL,
+	})
+
+	return f
+}
+
+// unchanged tells if data updated at last was already
+// loaded at update_time, slurmctld compares the same way.
+
+func unchanged(update_time C.time_t, last int64) bool {
+	return update_time != 0 && int64(update_time)-1 >= last
+}
+
+func fake_alloc(mem *arena, count int, size uintptr) unsafe.Pointer {
+	ret := C.calloc(C.size_t(count+1), C.size_t(size))
+
+	if ret == nil {
+		panic("out of memory")
+	}
+
+	mem.ptrs = append(mem.ptrs, ret)
+
+	return ret
+}
+
+func fake_string(mem *arena, s string) *C.char {
+	if s == "" {
+		return nil
+	}
+
+	ret := C.CString(s)
+	mem.ptrs = append(mem.ptrs, unsafe.Pointer(ret))
+
+	return ret
+}
+
+func go_string(s *C.char) string {
+	if s == nil {
+		return ""
+	}
+	return C.GoString(s)
+}
+
+func node_names(nodes []*fake_node) string {
+	names := make([]string, len(nodes))
+
+	for i, n := range nodes {
+		names[i] = n.name
+	}
+
+	return strings.Join(names, ",")
+}
+
+func job_active(state uint32) bool {
+	switch state & C.JOB_STATE_BASE {
+	case C.JOB_PENDING, C.JOB_RUNNING, C.JOB_SUSPENDED:
+		return true
+	}
+	return false
+}
+
+func (f *fake_cluster) Free(msg interface{}) {
+	f.Lock()
+	mem := f.msgs[msg]
+	delete(f.msgs, msg)
+	f.Unlock()
+
+	if mem != nil {
+		mem.Free()
+	}
+}
+
+func (f *fake_cluster) find_job(id C.uint32_t) *fake_job {
+	for _, j := range f.jobs {
+		if j.id == uint32(id) {
+			return j
+		}
+	}
+	return nil
+}
+
+func (f *fake_cluster) find_node(name string) *fake_node {
+	for _, n := range f.nodes {
+		if n.name == name {
+			return n
+		}
+	}
+	return nil
+}
+
+// find_nodes returns the nodes of a comma separated list, or
+// all of them for ALL.
+
+func (f *fake_cluster) find_nodes(list string) ([]*fake_node, bool) {
+	if list == "ALL" {
+		return f.nodes, true
+	}
+
+	ret := make([]*fake_node, 0)
+
+	for _, name := range strings.Split(list, ",") {
+		n := f.find_node(strings.TrimSpace(name))
+		if n == nil {
+			return nil, false
+		}
+		ret = append(ret, n)
+	}
+
+	return ret, true
+}
+
+func (f *fake_cluster) find_partition(name string) *fake_partition {
+	for _, p := range f.partitions {
+		if name == "" && p.flags&C.PART_FLAG_DEFAULT != 0 || p.name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+func (f *fake_cluster) find_reservation(name string) *fake_reservation {
+	for _, r := range f.reservations {
+		if r.name == name {
+			return r
+		}
+	}
+	return nil
+}
+
+// node_job returns the job running on a node
+
+func (f *fake_cluster) node_job(n *fake_node) *fake_job {
+	for _, j := range f.jobs {
+		if !job_active(j.state) {
+			continue
+		}
+		for _, v := range j.nodes {
+			if v == n {
+				return j
+			}
+		}
+	}
+	return nil
+}
+
+func (f *fake_cluster) node_state(n *fake_node) uint32 {
+	base := n.state & C.NODE_STATE_BASE
+
+	if base != C.NODE_STATE_DOWN && f.node_job(n) != nil {
+		base = C.NODE_STATE_ALLOCATED
+	}
+
+	return base | n.state&C.NODE_STATE_FLAGS
+}
+
+func (f *fake_cluster) node_usable(n *fake_node) bool {
+	return n.state&C.NODE_STATE_BASE != C.NODE_STATE_DOWN &&
+		n.state&C.NODE_STATE_DRAIN == 0
+}
+
+// schedule starts the pending jobs in order of submission
+// on the first idle nodes of their partition.
+
+func (f *fake_cluster) schedule() {
+	now := time.Now().Unix()
+
+	for _, j := range f.jobs {
+		if j.state != C.JOB_PENDING || j.priority == 0 {
+			continue
+		}
+
+		p := f.find_partition(j.partition)
+
+		if p == nil || p.state_up&C.PARTITION_SCHED == 0 {
+			j.reason = C.WAIT_PART_DOWN
+			continue
+		}
+
+		nodes := make([]*fake_node, 0, j.min_nodes)
+
+		for _, n := range p.nodes {
+			if uint32(len(nodes)) == j.min_nodes {
+				break
+			}
+			if f.node_usable(n) && f.node_job(n) == nil {
+				nodes = append(nodes, n)
+			}
+		}
+
+		if uint32(len(nodes)) < j.min_nodes {
+			j.reason = C.WAIT_RESOURCES
+			continue
+		}
+
+		j.state = C.JOB_RUNNING
+		j.reason = C.WAIT_NO_REASON
+		j.nodes = nodes
+		j.step = j.batch
+		j.start_time = now
+		j.end_time = end_time(now, j.time_limit)
+		f.stats.started++
+		f.job_update = now
+		f.node_update = now
+	}
+}
+
+func end_time(start int64, time_limit uint32) int64 {
+	if time_limit == C.INFINITE || time_limit == C.NO_VAL {
+		return start + 365*24*3600
+	}
+	return start + int64(time_limit)*60
+}
+
+// end stops a job in the given state and frees its nodes
+
+func (f *fake_cluster) end(j *fake_job, state uint32) {
+	now := time.Now().Unix()
+
+	if j.state == C.JOB_PENDING {
+		j.start_time = now
+	}
+
+	j.state = state
+	j.reason = C.WAIT_NO_REASON
+	j.step = false
+	j.end_time = now
+	f.job_update = now
+	f.node_update = now
+
+	switch state {
+	case C.JOB_COMPLETE:
+		f.stats.completed++
+	case C.JOB_CANCELLED:
+		f.stats.canceled++
+	default:
+		f.stats.failed++
+	}
+
+	f.schedule()
+}
+
+// new_job checks a job request like slurmctld does
+
+func (f *fake_cluster) new_job(req *C.job_desc_msg_t, batch bool) (*fake_job, C.int) {
+	if batch && req.script == nil {
+		return nil, C.ESLURM_JOB_SCRIPT_MISSING
+	}
+
+	if req.user_id == C.NO_VAL {
+		return nil, C.ESLURM_USER_ID_MISSING
+	}
+
+	p := f.find_partition(go_string(req.partition))
+
+	if p == nil {
+		if req.partition == nil {
+			return nil, C.ESLURM_DEFAULT_PARTITION_NOT_SET
+		}
+		return nil, C.ESLURM_INVALID_PARTITION_NAME
+	}
+
+	if p.state_up&C.PARTITION_SUBMIT == 0 {
+		return nil, C.ESLURM_PARTITION_NOT_AVAIL
+	}
+
+	j := &fake_job{
+		user_id:     uint32(req.user_id),
+		group_id:    uint32(req.group_id),
+		name:        go_string(req.name),
+		partition:   p.name,
+		work_dir:    go_string(req.work_dir),
+		std_out:     go_string(req.std_out),
+		std_err:     go_string(req.std_err),
+		comment:     go_string(req.comment),
+		batch:       batch,
+		state:       C.JOB_PENDING,
+		reason:      C.WAIT_PRIORITY,
+		priority:    1,
+		min_nodes:   1,
+		time_limit:  uint32(req.time_limit),
+		submit_time: time.Now().Unix(),
+	}
+
+	if req.group_id == C.NO_VAL {
+		j.group_id = j.user_id
+	}
+
+	if req.priority != C.NO_VAL && req.priority != C.INFINITE {
+		j.priority = uint32(req.priority)
+	}
+
+	if req.min_nodes != C.NO_VAL && req.min_nodes != 0 {
+		j.min_nodes = uint32(req.min_nodes)
+	}
+
+	if j.min_nodes > uint32(len(p.nodes)) || j.min_nodes > p.max_nodes {
+		return nil, C.ESLURM_INVALID_NODE_COUNT
+	}
+
+	if j.time_limit == C.NO_VAL {
+		j.time_limit = p.default_time
+	}
+
+	if j.time_limit == C.NO_VAL {
+		j.time_limit = p.max_time
+	}
+
+	if p.max_time != C.INFINITE && j.time_limit > p.max_time {
+		return nil, C.ESLURM_INVALID_TIME_LIMIT
+	}
+
+	j.num_cpus = j.min_nodes * fake_cpus
+
+	return j, 0
+}
+
+func (f *fake_cluster) add_job(j *fake_job) {
+	j.id = f.next_job
+	f.next_job++
+	f.jobs = append(f.jobs, j)
+	f.stats.submitted++
+	f.job_update = time.Now().Unix()
+	f.schedule()
+}
+
+func (f *fake_cluster) SubmitBatchJob(req *C.job_desc_msg_t) (*C.submit_response_msg_t, C.int) {
+	f.Lock()
+	defer f.Unlock()
+
+	j, errno := f.new_job(req, true)
+
+	if errno != 0 {
+		return nil, errno
+	}
+
+	f.add_job(j)
+
+	mem := &arena{}
+	msg := (*C.submit_response_msg_t)(fake_alloc(mem, 1, unsafe.Sizeof(C.submit_response_msg_t{})))
+	msg.job_id = C.uint32_t(j.id)
+	msg.step_id = C.NO_VAL
+	f.msgs[msg] = mem
+
+	return msg, 0
+}
+
+func (f *fake_cluster) allocation(j *fake_job) *C.resource_allocation_response_msg_t {
+	mem := &arena{}
+	msg := (*C.resource_allocation_response_msg_t)(fake_alloc(mem, 1, unsafe.Sizeof(C.resource_allocation_response_msg_t{})))
+	msg.job_id = C.uint32_t(j.id)
+	msg.partition = fake_string(mem, j.partition)
+	msg.node_list = fake_string(mem, node_names(j.nodes))
+	msg.node_cnt = C.uint32_t(len(j.nodes))
+	msg.pn_min_memory = C.NO_VAL64
+	f.msgs[msg] = mem
+
+	return msg
+}
+
+func (f *fake_cluster) AllocateResources(req *C.job_desc_msg_t) (*C.resource_allocation_response_msg_t, C.int) {
+	f.Lock()
+	defer f.Unlock()
+
+	j, errno := f.new_job(req, false)
+
+	if errno != 0 {
+		return nil, errno
+	}
+
+	f.add_job(j)
+
+	return f.allocation(j), 0
+}
+
+func (f *fake_cluster) AllocationLookup(job_id C.uint32_t) (*C.resource_allocation_response_msg_t, C.int) {
+	f.Lock()
+	defer f.Unlock()
+
+	j := f.find_job(job_id)
+
+	switch {
+	case j == nil:
+		return nil, C.ESLURM_INVALID_JOB_ID
+	case j.state == C.JOB_PENDING:
+		return nil, C.ESLURM_JOB_PENDING
+	case !job_active(j.state):
+		return nil, C.ESLURM_ALREADY_DONE
+	}
+
+	return f.allocation(j), 0
+}
+
+// JobWillRun gives the first nodes to be free for the job,
+// the running jobs are expected to use their whole time limit.
+
+func (f *fake_cluster) JobWillRun(req *C.job_desc_msg_t) (*C.will_run_response_msg_t, C.int) {
+	f.Lock()
+	defer f.Unlock()
+
+	j, errno := f.new_job(req, false)
+
+	if errno != 0 {
+		return nil, errno
+	}
+
+	now := time.Now().Unix()
+	p := f.find_partition(j.partition)
+	nodes := make([]*fake_node, 0)
+	free := make(map[*fake_node]int64)
+
+	for _, n := range p.nodes {
+		if !f.node_usable(n) {
+			continue
+		}
+		free[n] = now
+		if r := f.node_job(n); r != nil {
+			free[n] = r.end_time
+		}
+		nodes = append(nodes, n)
+	}
+
+	if uint32(len(nodes)) < j.min_nodes {
+		return nil, C.ESLURM_NODES_BUSY
+	}
+
+	sort.SliceStable(nodes, func(i, k int) bool {
+		return free[nodes[i]] < free[nodes[k]]
+	})
+
+	nodes = nodes[:j.min_nodes]
+
+	mem := &arena{}
+	msg := (*C.will_run_response_msg_t)(fake_alloc(mem, 1, unsafe.Sizeof(C.will_run_response_msg_t{})))
+	msg.node_list = fake_string(mem, node_names(nodes))
+	msg.part_name = fake_string(mem, p.name)
+	msg.proc_cnt = C.uint32_t(j.num_cpus)
+	msg.start_time = C.time_t(free[nodes[len(nodes)-1]])
+	f.msgs[msg] = mem
+
+	return msg, 0
+}
+
+func (f *fake_cluster) UpdateJob(req *C.job_desc_msg_t) C.int {
+	f.Lock()
+	defer f.Unlock()
+
+	job_id := req.job_id
+
+	// like slurmctld, job_id_str comes before job_id
+
+	if req.job_id_str != nil {
+		id, err := strconv.ParseUint(C.GoString(req.job_id_str), 10, 32)
+		if err != nil {
+			return C.ESLURM_INVALID_JOB_ID
+		}
+		job_id = C.uint32_t(id)
+	}
+
+	j := f.find_job(job_id)
+
+	switch {
+	case j == nil:
+		return C.ESLURM_INVALID_JOB_ID
+	case !job_active(j.state):
+		return C.ESLURM_JOB_FINISHED
+	}
+
+	pending := j.state == C.JOB_PENDING
+
+	if req.partition != nil {
+		if !pending {
+			return C.ESLURM_JOB_NOT_PENDING
+		}
+		if f.find_partition(C.GoString(req.partition)) == nil {
+			return C.ESLURM_INVALID_PARTITION_NAME
+		}
+		j.partition = C.GoString(req.partition)
+	}
+
+	if req.min_nodes != C.NO_VAL && req.min_nodes != 0 {
+		if !pending {
+			return C.ESLURM_JOB_NOT_PENDING
+		}
+		j.min_nodes = uint32(req.min_nodes)
+		j.num_cpus = j.min_nodes * fake_cpus
+	}
+
+	if req.name != nil {
+		j.name = C.GoString(req.name)
+	}
+
+	if req.comment != nil {
+		j.comment = C.GoString(req.comment)
+	}
+
+	if req.priority != C.NO_VAL {
+		j.priority = uint32(req.priority)
+		if j.priority == C.INFINITE {
+			j.priority = 1
+		}
+	}
+
+	if req.time_limit != C.NO_VAL {
+		j.time_limit = uint32(req.time_limit)
+		if !pending {
+			j.end_time = end_time(j.start_time, j.time_limit)
+		}
+	}
+
+	if pending && j.priority == 0 {
+		j.reason = C.WAIT_HELD
+	}
+
+	f.job_update = time.Now().Unix()
+	f.schedule()
+
+	return 0
+}
+
+// job_running returns the errno of a request needing a running job
+
+func (f *fake_cluster) job_running(job_id C.uint32_t) (*fake_job, C.int) {
+	j := f.find_job(job_id)
+
+	switch {
+	case j == nil:
+		return nil, C.ESLURM_INVALID_JOB_ID
+	case j.state == C.JOB_PENDING:
+		return nil, C.ESLURM_JOB_PENDING
+	case !job_active(j.state):
+		return nil, C.ESLURM_ALREADY_DONE
+	}
+
+	return j, 0
+}
+
+func (f *fake_cluster) NotifyJob(job_id C.uint32_t, message *C.char) C.int {
+	f.Lock()
+	defer f.Unlock()
+
+	_, errno := f.job_running(job_id)
+
+	return errno
+}
+
+func (f *fake_cluster) job_msg(jobs []*fake_job) *C.job_info_msg_t {
+	mem := &arena{}
+	msg := (*C.job_info_msg_t)(fake_alloc(mem, 1, unsafe.Sizeof(C.job_info_msg_t{})))
+	data := fake_alloc(mem, len(jobs), unsafe.Sizeof(C.job_info_t{}))
+	carray := *(*[]C.job_info_t)(unsafe.Pointer(&reflect.SliceHeader{
+		Data: uintptr(data),
+		Len:  len(jobs),
+		Cap:  len(jobs),
+	}))
+
+	for i, j := range jobs {
+		c := &carray[i]
+		c.job_id = C.uint32_t(j.id)
+		c.array_task_id = C.NO_VAL
+		c.user_id = C.uint32_t(j.user_id)
+		c.group_id = C.uint32_t(j.group_id)
+		c.name = fake_string(mem, j.name)
+		c.partition = fake_string(mem, j.partition)
+		c.work_dir = fake_string(mem, j.work_dir)
+		c.std_out = fake_string(mem, j.std_out)
+		c.std_err = fake_string(mem, j.std_err)
+		c.comment = fake_string(mem, j.comment)
+		c.job_state = C.uint32_t(j.state)
+		c.state_reason = C.uint16_t(j.reason)
+		c.priority = C.uint32_t(j.priority)
+		c.num_nodes = C.uint32_t(j.min_nodes)
+		c.num_cpus = C.uint32_t(j.num_cpus)
+		c.time_limit = C.uint32_t(j.time_limit)
+		c.exit_code = C.uint32_t(j.exit_code)
+		c.pn_min_memory = C.NO_VAL64
+		c.submit_time = C.time_t(j.submit_time)
+		c.eligible_time = C.time_t(j.submit_time)
+		c.start_time = C.time_t(j.start_time)
+		c.end_time = C.time_t(j.end_time)
+		c.show_flags = C.SHOW_ALL
+		if len(j.nodes) > 0 {
+			c.nodes = fake_string(mem, node_names(j.nodes))
+			c.batch_host = fake_string(mem, j.nodes[0].name)
+		}
+	}
+
+	msg.last_update = C.time_t(f.job_update)
+	msg.record_count = C.uint32_t(len(jobs))
+	msg.job_array = (*C.job_info_t)(data)
+	f.msgs[msg] = mem
+
+	return msg
+}
+
+func (f *fake_cluster) LoadJobs(update_time C.time_t, show_flags C.uint16_t) (*C.job_info_msg_t, C.int) {
+	f.Lock()
+	defer f.Unlock()
+
+	if unchanged(update_time, f.job_update) {
+		return nil, C.SLURM_NO_CHANGE_IN_DATA
+	}
+
+	return f.job_msg(f.jobs), 0
+}
+
+func (f *fake_cluster) LoadJob(job_id C.uint32_t, show_flags C.uint16_t) (*C.job_info_msg_t, C.int) {
+	f.Lock()
+	defer f.Unlock()
+
+	j := f.find_job(job_id)
+
+	if j == nil {
+		return nil, C.ESLURM_INVALID_JOB_ID
+	}
+
+	return f.job_msg([]*fake_job{j}), 0
+}
+
+// GetJobSteps gives the step 0 of the running batch jobs
+
+func (f *fake_cluster) GetJobSteps(update_time C.time_t, job_id, step_id C.uint32_t, show_flags C.uint16_t) (*C.job_step_info_response_msg_t, C.int) {
+	f.Lock()
+	defer f.Unlock()
+
+	if job_id != C.NO_VAL && f.find_job(job_id) == nil {
+		return nil, C.ESLURM_INVALID_JOB_ID
+	}
+
+	if unchanged(update_time, f.job_update) {
+		return nil, C.SLURM_NO_CHANGE_IN_DATA
+	}
+
+	jobs := make([]*fake_job, 0)
+
+	for _, j := range f.jobs {
+		if j.step && (job_id == C.NO_VAL || j.id == uint32(job_id)) && (step_id == C.NO_VAL || step_id == 0) {
+			jobs = append(jobs, j)
+		}
+	}
+
+	mem := &arena{}
+	msg := (*C.job_step_info_response_msg_t)(fake_alloc(mem, 1, unsafe.Sizeof(C.job_step_info_response_msg_t{})))
+	data := fake_alloc(mem, len(jobs), unsafe.Sizeof(C.job_step_info_t{}))
+	carray := *(*[]C.job_step_info_t)(unsafe.Pointer(&reflect.SliceHeader{
+		Data: uintptr(data),
+		Len:  len(jobs),
+		Cap:  len(jobs),
+	}))
+
+	for i, j := range jobs {
+		c := &carray[i]
+		c.job_id = C.uint32_t(j.id)
+		c.array_task_id = C.NO_VAL
+		c.name = fake_string(mem, j.name)
+		c.partition = fake_string(mem, j.partition)
+		c.nodes = fake_string(mem, node_names(j.nodes))
+		c.num_cpus = C.uint32_t(j.num_cpus)
+		c.num_tasks = C.uint32_t(len(j.nodes))
+		c.state = C.uint32_t(j.state)
+		c.start_time = C.time_t(j.start_time)
+		c.run_time = C.time_t(time.Now().Unix() - j.start_time)
+		c.time_limit = C.uint32_t(j.time_limit)
+		c.user_id = C.uint32_t(j.user_id)
+	}
+
+	msg.last_update = C.time_t(f.job_update)
+	msg.job_step_count = C.uint32_t(len(jobs))
+	msg.job_steps = (*C.job_step_info_t)(data)
+	f.msgs[msg] = mem
+
+	return msg, 0
+}
+
+func (f *fake_cluster) signal(job_id C.uint32_t, signal int) C.int {
+	j := f.find_job(job_id)
+
+	switch {
+	case j == nil:
+		return C.ESLURM_INVALID_JOB_ID
+	case !job_active(j.state):
+		return C.ESLURM_ALREADY_DONE
+	}
+
+	switch {
+	case signal == C.SIGKILL:
+		f.end(j, C.JOB_CANCELLED)
+	case j.state == C.JOB_PENDING:
+		return C.ESLURM_JOB_PENDING
+	}
+
+	return 0
+}
+
+func (f *fake_cluster) SignalJob(job_id C.uint32_t, signal C.uint16_t) C.int {
+	f.Lock()
+	defer f.Unlock()
+
+	return f.signal(job_id, int(signal))
+}
+
+// KillJob cancels the pending jobs with any signal,
+// like scancel does.
+
+func (f *fake_cluster) KillJob(job_id C.uint32_t, signal, flags C.uint16_t) C.int {
+	f.Lock()
+	defer f.Unlock()
+
+	if j := f.find_job(job_id); j != nil && j.state == C.JOB_PENDING {
+		f.end(j, C.JOB_CANCELLED)
+		return 0
+	}
+
+	return f.signal(job_id, int(signal))
+}
+
+func (f *fake_cluster) job_step(job_id, step_id C.uint32_t) (*fake_job, C.int) {
+	j, errno := f.job_running(job_id)
+
+	if errno != 0 {
+		return nil, errno
+	}
+
+	if !j.step || step_id != 0 {
+		return nil, C.ESLURM_INVALID_JOB_ID
+	}
+
+	return j, 0
+}
+
+func (f *fake_cluster) SignalJobStep(job_id, step_id, signal C.uint32_t) C.int {
+	return f.KillJobStep(job_id, step_id, C.uint16_t(signal))
+}
+
+func (f *fake_cluster) KillJobStep(job_id, step_id C.uint32_t, signal C.uint16_t) C.int {
+	f.Lock()
+	defer f.Unlock()
+
+	j, errno := f.job_step(job_id, step_id)
+
+	if errno != 0 {
+		return errno
+	}
+
+	if signal == C.SIGKILL {
+		j.step = false
+		f.job_update = time.Now().Unix()
+	}
+
+	return 0
+}
+
+func (f *fake_cluster) TerminateJobStep(job_id, step_id C.uint32_t) C.int {
+	return f.KillJobStep(job_id, step_id, C.SIGKILL)
+}
+
+func (f *fake_cluster) CompleteJob(job_id, return_code C.uint32_t) C.int {
+	f.Lock()
+	defer f.Unlock()
+
+	j, errno := f.job_running(job_id)
+
+	if errno != 0 {
+		return errno
+	}
+
+	j.exit_code = uint32(return_code)
+
+	if return_code == 0 {
+		f.end(j, C.JOB_COMPLETE)
+	} else {
+		f.end(j, C.JOB_FAILED)
+	}
+
+	return 0
+}
+
+func (f *fake_cluster) Suspend(job_id C.uint32_t) C.int {
+	f.Lock()
+	defer f.Unlock()
+
+	j, errno := f.job_running(job_id)
+
+	switch {
+	case errno != 0:
+		return errno
+	case j.state == C.JOB_SUSPENDED:
+		return C.ESLURM_JOB_SUSPENDED
+	}
+
+	j.state = C.JOB_SUSPENDED
+	f.job_update = time.Now().Unix()
+
+	return 0
+}
+
+func (f *fake_cluster) Resume(job_id C.uint32_t) C.int {
+	f.Lock()
+	defer f.Unlock()
+
+	j, errno := f.job_running(job_id)
+
+	switch {
+	case errno != 0:
+		return errno
+	case j.state != C.JOB_SUSPENDED:
+		return C.ESLURM_JOB_NOT_SUSPENDED
+	}
+
+	j.state = C.JOB_RUNNING
+	f.job_update = time.Now().Unix()
+
+	return 0
+}
+
+func (f *fake_cluster) Requeue(job_id, state C.uint32_t) C.int {
+	f.Lock()
+	defer f.Unlock()
+
+	j := f.find_job(job_id)
+
+	switch {
+	case j == nil:
+		return C.ESLURM_INVALID_JOB_ID
+	case !j.batch:
+		return C.ESLURM_BATCH_ONLY
+	case j.state == C.JOB_PENDING:
+		return C.ESLURM_JOB_PENDING
+	}
+
+	now := time.Now().Unix()
+
+	j.state = C.JOB_PENDING
+	j.reason = C.WAIT_PRIORITY
+	j.nodes = nil
+	j.step = false
+	j.start_time = 0
+	j.end_time = 0
+	j.exit_code = 0
+	f.job_update = now
+	f.node_update = now
+	f.schedule()
+
+	return 0
+}
+
+func (f *fake_cluster) node_msg(nodes []*fake_node) *C.node_info_msg_t {
+	mem := &arena{}
+	msg := (*C.node_info_msg_t)(fake_alloc(mem, 1, unsafe.Sizeof(C.node_info_msg_t{})))
+	data := fake_alloc(mem, len(nodes), unsafe.Sizeof(C.node_info_t{}))
+	carray := *(*[]C.node_info_t)(unsafe.Pointer(&reflect.SliceHeader{
+		Data: uintptr(data),
+		Len:  len(nodes),
+		Cap:  len(nodes),
+	}))
+
+	for i, n := range nodes {
+		parts := make([]string, 0)
+		for _, p := range f.partitions {
+			for _, v := range p.nodes {
+				if v == n {
+					parts = append(parts, p.name)
+				}
+			}
+		}
+
+		c := &carray[i]
+		c.name = fake_string(mem, n.name)
+		c.node_hostname = fake_string(mem, n.name)
+		c.node_addr = fake_string(mem, n.name)
+		c.arch = fake_string(mem, "x86_64")
+		c.os = fake_string(mem, "Linux")
+		c.version = fake_string(mem, "18.08")
+		c.partitions = fake_string(mem, strings.Join(parts, ","))
+		c.node_state = C.uint32_t(f.node_state(n))
+		c.cpus = C.uint16_t(n.cpus)
+		c.cores = C.uint16_t(n.cpus)
+		c.sockets = 1
+		c.threads = 1
+		c.real_memory = C.uint64_t(n.memory)
+		c.free_mem = C.uint64_t(n.memory)
+		c.weight = 1
+		c.owner = C.NO_VAL
+		c.boot_time = C.time_t(f.start)
+		c.slurmd_start_time = C.time_t(f.start)
+		c.reason = fake_string(mem, n.reason)
+		c.reason_time = C.time_t(n.reason_time)
+		c.reason_uid = C.uint32_t(n.reason_uid)
+	}
+
+	msg.last_update = C.time_t(f.node_update)
+	msg.record_count = C.uint32_t(len(nodes))
+	msg.node_array = (*C.node_info_t)(data)
+	f.msgs[msg] = mem
+
+	return msg
+}
+
+func (f *fake_cluster) LoadNode(update_time C.time_t, show_flags C.uint16_t) (*C.node_info_msg_t, C.int) {
+	f.Lock()
+	defer f.Unlock()
+
+	if unchanged(update_time, f.node_update) {
+		return nil, C.SLURM_NO_CHANGE_IN_DATA
+	}
+
+	return f.node_msg(f.nodes), 0
+}
+
+func (f *fake_cluster) LoadNodeSingle(name *C.char, show_flags C.uint16_t) (*C.node_info_msg_t, C.int) {
+	f.Lock()
+	defer f.Unlock()
+
+	n := f.find_node(go_string(name))
+
+	if n == nil {
+		return nil, C.ESLURM_INVALID_NODE_NAME
+	}
+
+	return f.node_msg([]*fake_node{n}), 0
+}
+
+// UpdateNode sets a node down, drains or resumes it,
+// the jobs of a node set down fail.
+
+func (f *fake_cluster) UpdateNode(req *C.update_node_msg_t) C.int {
+	f.Lock()
+	defer f.Unlock()
+
+	nodes, ok := f.find_nodes(go_string(req.node_names))
+
+	if !ok {
+		return C.ESLURM_INVALID_NODE_NAME
+	}
+
+	state := uint32(req.node_state)
+
+	if state != C.NO_VAL {
+		switch {
+		case state == C.NODE_RESUME:
+		case state&C.NODE_STATE_DRAIN != 0:
+		case state&C.NODE_STATE_UNDRAIN != 0:
+		case state == C.NODE_STATE_DOWN, state == C.NODE_STATE_IDLE:
+		default:
+			return C.ESLURM_INVALID_NODE_STATE
+		}
+	}
+
+	now := time.Now().Unix()
+
+	for _, n := range nodes {
+		switch {
+		case state == C.NO_VAL:
+		case state == C.NODE_RESUME:
+			n.state = C.NODE_STATE_IDLE
+		case state&C.NODE_STATE_DRAIN != 0:
+			n.state |= C.NODE_STATE_DRAIN
+		case state&C.NODE_STATE_UNDRAIN != 0:
+			n.state &^= C.NODE_STATE_DRAIN
+		default:
+			n.state = state | n.state&C.NODE_STATE_FLAGS
+		}
+
+		if req.reason != nil {
+			n.reason = C.GoString(req.reason)
+			n.reason_time = now
+			n.reason_uid = uint32(req.reason_uid)
+		}
+
+		if state == C.NODE_RESUME {
+			n.reason = ""
+			n.reason_time = 0
+		}
+
+		if state == C.NODE_STATE_DOWN {
+			if j := f.node_job(n); j != nil && j.state != C.JOB_PENDING {
+				f.end(j, C.JOB_NODE_FAIL)
+			}
+		}
+	}
+
+	f.node_update = now
+	f.schedule()
+
+	return 0
+}
+
+// the fake cluster has no front end nodes
+
+func (f *fake_cluster) LoadFrontEnd(update_time C.time_t) (*C.front_end_info_msg_t, C.int) {
+	f.Lock()
+	defer f.Unlock()
+
+	if unchanged(update_time, f.start) {
+		return nil, C.SLURM_NO_CHANGE_IN_DATA
+	}
+
+	mem := &arena{}
+	msg := (*C.front_end_info_msg_t)(fake_alloc(mem, 1, unsafe.Sizeof(C.front_end_info_msg_t{})))
+	msg.last_update = C.time_t(f.start)
+	f.msgs[msg] = mem
+
+	return msg, 0
+}
+
+func (f *fake_cluster) UpdateFrontEnd(req *C.update_front_end_msg_t) C.int {
+	return C.ESLURM_INVALID_NODE_NAME
+}
+
+// LoadTopo gives a single switch connecting all the nodes
+
+func (f *fake_cluster) LoadTopo() (*C.topo_info_response_msg_t, C.int) {
+	f.Lock()
+	defer f.Unlock()
+
+	mem := &arena{}
+	msg := (*C.topo_info_response_msg_t)(fake_alloc(mem, 1, unsafe.Sizeof(C.topo_info_response_msg_t{})))
+	topo := (*C.topo_info_t)(fake_alloc(mem, 1, unsafe.Sizeof(C.topo_info_t{})))
+	topo.name = fake_string(mem, "switch0")
+	topo.nodes = fake_string(mem, node_names(f.nodes))
+	msg.record_count = 1
+	msg.topo_array = topo
+	f.msgs[msg] = mem
+
+	return msg, 0
+}
+
+func (f *fake_cluster) LoadPartitions(update_time C.time_t, show_flags C.uint16_t) (*C.partition_info_msg_t, C.int) {
+	f.Lock()
+	defer f.Unlock()
+
+	if unchanged(update_time, f.part_update) {
+		return nil, C.SLURM_NO_CHANGE_IN_DATA
+	}
+
+	mem := &arena{}
+	msg := (*C.partition_info_msg_t)(fake_alloc(mem, 1, unsafe.Sizeof(C.partition_info_msg_t{})))
+	data := fake_alloc(mem, len(f.partitions), unsafe.Sizeof(C.partition_info_t{}))
+	carray := *(*[]C.partition_info_t)(unsafe.Pointer(&reflect.SliceHeader{
+		Data: uintptr(data),
+		Len:  len(f.partitions),
+		Cap:  len(f.partitions),
+	}))
+
+	for i, p := range f.partitions {
+		c := &carray[i]
+		c.name = fake_string(mem, p.name)
+		c.nodes = fake_string(mem, node_names(p.nodes))
+		c.state_up = C.uint16_t(p.state_up)
+		c.flags = C.uint16_t(p.flags)
+		c.max_time = C.uint32_t(p.max_time)
+		c.max_nodes = C.uint32_t(p.max_nodes)
+		c.min_nodes = 1
+		c.default_time = C.uint32_t(p.default_time)
+		c.def_mem_per_cpu = C.NO_VAL64
+		c.max_mem_per_cpu = C.NO_VAL64
+		c.max_cpus_per_node = C.INFINITE
+		c.total_nodes = C.uint32_t(len(p.nodes))
+		c.total_cpus = C.uint32_t(len(p.nodes) * fake_cpus)
+	}
+
+	msg.last_update = C.time_t(f.part_update)
+	msg.record_count = C.uint32_t(len(f.partitions))
+	msg.partition_array = (*C.partition_info_t)(data)
+	f.msgs[msg] = mem
+
+	return msg, 0
+}
+
+// set_partition applies the keys given to create or update a partition
+
+func (f *fake_cluster) set_partition(p *fake_partition, req *C.update_part_msg_t) C.int {
+	if req.nodes != nil {
+		nodes, ok := f.find_nodes(C.GoString(req.nodes))
+		if !ok {
+			return C.ESLURM_INVALID_NODE_NAME
+		}
+		p.nodes = nodes
+	}
+
+	if req.state_up != C.NO_VAL16 {
+		p.state_up = uint16(req.state_up)
+	}
+
+	if req.flags != C.NO_VAL16 && req.flags != 0 {
+		p.flags = uint16(req.flags)
+	}
+
+	if req.max_time != C.NO_VAL {
+		p.max_time = uint32(req.max_time)
+	}
+
+	if req.max_nodes != C.NO_VAL {
+		p.max_nodes = uint32(req.max_nodes)
+	}
+
+	if req.default_time != C.NO_VAL {
+		p.default_time = uint32(req.default_time)
+	}
+
+	if p.flags&C.PART_FLAG_DEFAULT != 0 {
+		for _, v := range f.partitions {
+			if v != p {
+				v.flags &^= C.PART_FLAG_DEFAULT
+			}
+		}
+	}
+
+	now := time.Now().Unix()
+	f.part_update = now
+	f.node_update = now
+	f.schedule()
+
+	return 0
+}
+
+func (f *fake_cluster) CreatePartition(req *C.update_part_msg_t) C.int {
+	f.Lock()
+	defer f.Unlock()
+
+	name := go_string(req.name)
+
+	if name == "" || f.find_partition(name) != nil {
+		return C.ESLURM_INVALID_PARTITION_NAME
+	}
+
+	p := &fake_partition{
+		name:         name,
+		state_up:     C.PARTITION_UP,
+		max_time:     C.INFINITE,
+		max_nodes:    C.INFINITE,
+		default_time: C.NO_VAL,
+	}
+
+	if errno := f.set_partition(p, req); errno != 0 {
+		return errno
+	}
+
+	f.partitions = append(f.partitions, p)
+
+	return 0
+}
+
+func (f *fake_cluster) UpdatePartition(req *C.update_part_msg_t) C.int {
+	f.Lock()
+	defer f.Unlock()
+
+	p := f.find_partition(go_string(req.name))
+
+	if req.name == nil || p == nil {
+		return C.ESLURM_INVALID_PARTITION_NAME
+	}
+
+	return f.set_partition(p, req)
+}
+
+func (f *fake_cluster) DeletePartition(req *C.delete_part_msg_t) C.int {
+	f.Lock()
+	defer f.Unlock()
+
+	name := go_string(req.name)
+
+	for i, p := range f.partitions {
+		if p.name != name {
+			continue
+		}
+		for _, j := range f.jobs {
+			if j.partition == name && job_active(j.state) {
+				return C.ESLURM_PARTITION_IN_USE
+			}
+		}
+		f.partitions = append(f.partitions[:i], f.partitions[i+1:]...)
+		f.part_update = time.Now().Unix()
+		f.node_update = f.part_update
+		return 0
+	}
+
+	return C.ESLURM_INVALID_PARTITION_NAME
+}
+
+func (f *fake_cluster) LoadReservations(update_time C.time_t) (*C.reserve_info_msg_t, C.int) {
+	f.Lock()
+	defer f.Unlock()
+
+	if unchanged(update_time, f.resv_update) {
+		return nil, C.SLURM_NO_CHANGE_IN_DATA
+	}
+
+	mem := &arena{}
+	msg := (*C.reserve_info_msg_t)(fake_alloc(mem, 1, unsafe.Sizeof(C.reserve_info_msg_t{})))
+	data := fake_alloc(mem, len(f.reservations), unsafe.Sizeof(C.reserve_info_t{}))
+	carray := *(*[]C.reserve_info_t)(unsafe.Pointer(&reflect.SliceHeader{
+		Data: uintptr(data),
+		Len:  len(f.reservations),
+		Cap:  len(f.reservations),
+	}))
+
+	for i, r := range f.reservations {
+		c := &carray[i]
+		c.name = fake_string(mem, r.name)
+		c.node_list = fake_string(mem, node_names(r.nodes))
+		c.node_cnt = C.uint32_t(len(r.nodes))
+		c.core_cnt = C.uint32_t(len(r.nodes) * fake_cpus)
+		c.partition = fake_string(mem, r.partition)
+		c.users = fake_string(mem, r.users)
+		c.accounts = fake_string(mem, r.accounts)
+		c.flags = C.uint32_t(r.flags)
+		c.start_time = C.time_t(r.start_time)
+		c.end_time = C.time_t(r.end_time)
+	}
+
+	msg.last_update = C.time_t(f.resv_update)
+	msg.record_count = C.uint32_t(len(f.reservations))
+	msg.reservation_array = (*C.reserve_info_t)(data)
+	f.msgs[msg] = mem
+
+	return msg, 0
+}
+
+// set_reservation applies the keys given to create or update a reservation
+
+func (f *fake_cluster) set_reservation(r *fake_reservation, req *C.resv_desc_msg_t) C.int {
+	if req.node_list != nil {
+		nodes, ok := f.find_nodes(C.GoString(req.node_list))
+		if !ok {
+			return C.ESLURM_INVALID_NODE_NAME
+		}
+		r.nodes = nodes
+	} else if req.node_cnt != nil && *req.node_cnt != 0 {
+		count := int(*req.node_cnt)
+		if count > len(f.nodes) {
+			return C.ESLURM_INVALID_NODE_COUNT
+		}
+		r.nodes = f.nodes[:count]
+	}
+
+	if req.partition != nil {
+		if f.find_partition(C.GoString(req.partition)) == nil {
+			return C.ESLURM_INVALID_PARTITION_NAME
+		}
+		r.partition = C.GoString(req.partition)
+	}
+
+	if req.users != nil {
+		r.users = C.GoString(req.users)
+	}
+
+	if req.accounts != nil {
+		r.accounts = C.GoString(req.accounts)
+	}
+
+	if req.flags != C.NO_VAL {
+		r.flags = uint32(req.flags)
+	}
+
+	if req.start_time != C.NO_VAL {
+		r.start_time = int64(req.start_time)
+	}
+
+	switch {
+	case req.end_time != C.NO_VAL:
+		r.end_time = int64(req.end_time)
+	case req.duration != C.NO_VAL:
+		r.end_time = end_time(r.start_time, uint32(req.duration))
+	}
+
+	if len(r.nodes) == 0 {
+		return C.ESLURM_INVALID_NODE_COUNT
+	}
+
+	if r.end_time <= r.start_time {
+		return C.ESLURM_INVALID_TIME_VALUE
+	}
+
+	return 0
+}
+
+func (f *fake_cluster) CreateReservation(req *C.resv_desc_msg_t) (string, C.int) {
+	f.Lock()
+	defer f.Unlock()
+
+	now := time.Now().Unix()
+
+	r := &fake_reservation{
+		name:       go_string(req.name),
+		start_time: now,
+		end_time:   end_time(now, C.INFINITE),
+	}
+
+	if r.name == "" {
+		r.name = "resv" + strconv.Itoa(f.next_resv)
+	}
+
+	if f.find_reservation(r.name) != nil {
+		return "", C.ESLURM_RESERVATION_NAME_DUP
+	}
+
+	if errno := f.set_reservation(r, req); errno != 0 {
+		return "", errno
+	}
+
+	f.next_resv++
+	f.reservations = append(f.reservations, r)
+	f.resv_update = now
+
+	return r.name, 0
+}
+
+func (f *fake_cluster) UpdateReservation(req *C.resv_desc_msg_t) C.int {
+	f.Lock()
+	defer f.Unlock()
+
+	r := f.find_reservation(go_string(req.name))
+
+	if r == nil {
+		return C.ESLURM_RESERVATION_INVALID
+	}
+
+	tmp := *r
+
+	if errno := f.set_reservation(&tmp, req); errno != 0 {
+		return errno
+	}
+
+	*r = tmp
+	f.resv_update = time.Now().Unix()
+
+	return 0
+}
+
+func (f *fake_cluster) DeleteReservation(req *C.reservation_name_msg_t) C.int {
+	f.Lock()
+	defer f.Unlock()
+
+	name := go_string(req.name)
+
+	for i, r := range f.reservations {
+		if r.name == name {
+			f.reservations = append(f.reservations[:i], f.reservations[i+1:]...)
+			f.resv_update = time.Now().Unix()
+			return 0
+		}
+	}
+
+	return C.ESLURM_RESERVATION_INVALID
+}
+
+// the fake cluster has no licenses
+
+func (f *fake_cluster) LoadLicenses(update_time C.time_t, show_flags C.uint16_t) (*C.license_info_msg_t, C.int) {
+	f.Lock()
+	defer f.Unlock()
+
+	if unchanged(update_time, f.start) {
+		return nil, C.SLURM_NO_CHANGE_IN_DATA
+	}
+
+	mem := &arena{}
+	msg := (*C.license_info_msg_t)(fake_alloc(mem, 1, unsafe.Sizeof(C.license_info_msg_t{})))
+	msg.last_update = C.time_t(f.start)
+	f.msgs[msg] = mem
+
+	return msg, 0
+}
+
+func (f *fake_cluster) GetTriggers() (*C.trigger_info_msg_t, C.int) {
+	f.Lock()
+	defer f.Unlock()
+
+	mem := &arena{}
+	msg := (*C.trigger_info_msg_t)(fake_alloc(mem, 1, unsafe.Sizeof(C.trigger_info_msg_t{})))
+	data := fake_alloc(mem, len(f.triggers), unsafe.Sizeof(C.trigger_info_t{}))
+	carray := *(*[]C.trigger_info_t)(unsafe.Pointer(&reflect.SliceHeader{
+		Data: uintptr(data),
+		Len:  len(f.triggers),
+		Cap:  len(f.triggers),
+	}))
+
+	for i, t := range f.triggers {
+		c := &carray[i]
+		c.trig_id = C.uint32_t(t.id)
+		c.flags = C.uint16_t(t.flags)
+		c.res_type = C.uint16_t(t.res_type)
+		c.res_id = fake_string(mem, t.res_id)
+		c.trig_type = C.uint32_t(t.trig_type)
+		c.offset = C.uint16_t(t.offset)
+		c.user_id = C.uint32_t(t.user_id)
+		c.program = fake_string(mem, t.program)
+	}
+
+	msg.record_count = C.uint32_t(len(f.triggers))
+	msg.trigger_array = (*C.trigger_info_t)(data)
+	f.msgs[msg] = mem
+
+	return msg, 0
+}
+
+func (f *fake_cluster) SetTrigger(req *C.trigger_info_t) C.int {
+	f.Lock()
+	defer f.Unlock()
+
+	t := &fake_trigger{
+		flags:     uint16(req.flags),
+		res_type:  uint16(req.res_type),
+		res_id:    go_string(req.res_id),
+		trig_type: uint32(req.trig_type),
+		offset:    uint16(req.offset),
+		user_id:   uint32(req.user_id),
+		program:   go_string(req.program),
+	}
+
+	for _, v := range f.triggers {
+		if v.res_type == t.res_type && v.res_id == t.res_id &&
+			v.trig_type == t.trig_type && v.program == t.program {
+			return C.ESLURM_TRIGGER_DUP
+		}
+	}
+
+	t.id = f.next_trigger
+	f.next_trigger++
+	f.triggers = append(f.triggers, t)
+
+	return 0
+}
+
+// ClearTrigger removes the triggers by id, resource or user,
+// slurmctld answers ESRCH when none matches.
+
+func (f *fake_cluster) ClearTrigger(req *C.trigger_info_t) C.int {
+	f.Lock()
+	defer f.Unlock()
+
+	ret := make([]*fake_trigger, 0, len(f.triggers))
+
+	for _, t := range f.triggers {
+		switch {
+		case req.trig_id != 0 && req.trig_id != C.NO_VAL:
+			if t.id == uint32(req.trig_id) {
+				continue
+			}
+		case req.res_id != nil:
+			if t.res_id == C.GoString(req.res_id) {
+				continue
+			}
+		case req.user_id != C.NO_VAL:
+			if t.user_id == uint32(req.user_id) {
+				continue
+			}
+		}
+		ret = append(ret, t)
+	}
+
+	if len(ret) == len(f.triggers) {
+		return C.ESRCH
+	}
+
+	f.triggers = ret
+
+	return 0
+}
+
+func (f *fake_cluster) GetStatistics(req *C.stats_info_request_msg_t) (*C.stats_info_response_msg_t, C.int) {
+	f.Lock()
+	defer f.Unlock()
+
+	now := time.Now().Unix()
+
+	mem := &arena{}
+	msg := (*C.stats_info_response_msg_t)(fake_alloc(mem, 1, unsafe.Sizeof(C.stats_info_response_msg_t{})))
+	msg.req_time = C.time_t(now)
+	msg.req_time_start = C.time_t(f.stats.start)
+	msg.server_thread_count = 1
+	msg.jobs_submitted = C.uint32_t(f.stats.submitted)
+	msg.jobs_started = C.uint32_t(f.stats.started)
+	msg.jobs_completed = C.uint32_t(f.stats.completed)
+	msg.jobs_canceled = C.uint32_t(f.stats.canceled)
+	msg.jobs_failed = C.uint32_t(f.stats.failed)
+	msg.job_states_ts = C.time_t(now)
+
+	for _, j := range f.jobs {
+		switch j.state {
+		case C.JOB_PENDING:
+			msg.jobs_pending++
+		case C.JOB_RUNNING:
+			msg.jobs_running++
+		}
+	}
+
+	f.msgs[msg] = mem
+
+	return msg, 0
+}
+
+func (f *fake_cluster) ResetStatistics(req *C.stats_info_request_msg_t) C.int {
+	f.Lock()
+	defer f.Unlock()
+
+	f.stats.start = time.Now().Unix()
+	f.stats.submitted = 0
+	f.stats.started = 0
+	f.stats.completed = 0
+	f.stats.canceled = 0
+	f.stats.failed = 0
+
+	return 0
+}
+
+func (f *fake_cluster) LoadCtlConf(update_time C.time_t) (*C.slurm_conf_t, C.int) {
+	f.Lock()
+	defer f.Unlock()
+
+	if unchanged(update_time, f.start) {
+		return nil, C.SLURM_NO_CHANGE_IN_DATA
+	}
+
+	mem := &arena{}
+	msg := (*C.slurm_conf_t)(fake_alloc(mem, 1, unsafe.Sizeof(C.slurm_conf_t{})))
+	machines := (**C.char)(fake_alloc(mem, 1, unsafe.Sizeof((*C.char)(nil))))
+	*machines = fake_string(mem, "localhost")
+	msg.last_update = C.time_t(f.start)
+	msg.cluster_name = fake_string(mem, "fake")
+	msg.control_machine = machines
+	msg.control_cnt = 1
+	msg.min_job_age = 300
+	msg.batch_start_timeout = 10
+	f.msgs[msg] = mem
+
+	return msg, 0
+}
+
+// the fake cluster has a single controller that can't be stopped
+
+func (f *fake_cluster) Ping(primary C.int) C.int {
+	if primary != 0 {
+		return C.SLURMCTLD_COMMUNICATIONS_CONNECTION_ERROR
+	}
+	return 0
+}
+
+func (f *fake_cluster) Reconfigure() C.int {
+	return 0
+}
+
+func (f *fake_cluster) Shutdown(options C.uint16_t) C.int {
+	f.Lock()
+	defer f.Unlock()
+
+	f.shutdowns = append(f.shutdowns, options)
+
+	return 0
+}
+
+func (f *fake_cluster) Takeover(backup_inx C.int) C.int {
+	f.Lock()
+	defer f.Unlock()
+
+	f.takeovers = append(f.takeovers, backup_inx)
+
+	return 0
+}
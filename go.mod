@@ -0,0 +1,3 @@
+module github.com/angt/slurm-https
+
+go 1.18
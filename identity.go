@@ -0,0 +1,349 @@
+package main
+
+/*
+#include "slurm/slurm.h"
+*/
+import "C"
+
+import (
+	"bufio"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/user"
+	"reflect"
+	"strconv"
+	"strings"
+	"unsafe"
+)
+
+type identity struct {
+	Name string
+	Uid  uint32
+	Gid  uint32
+}
+
+type identity_config struct {
+	source string
+	oid    asn1.ObjectIdentifier
+	users  map[string]identity
+	strict bool
+}
+
+func (c *identity_config) SetSource(source string) error {
+	switch source {
+	case "cn", "email":
+		c.source = source
+		return nil
+	}
+
+	var oid asn1.ObjectIdentifier
+
+	for _, s := range strings.Split(source, ".") {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return errors.New("bad identity source: " + source)
+		}
+		oid = append(oid, n)
+	}
+
+	if len(oid) < 2 {
+		return errors.New("bad identity source: " + source)
+	}
+
+	c.source = "oid"
+	c.oid = oid
+
+	return nil
+}
+
+// the map file has one "subject user[:group]" entry per line,
+// user and group may be given by name or by numeric id.
+
+func (c *identity_config) Load(path string) error {
+	c.users = make(map[string]identity)
+
+	if path == "" {
+		return nil
+	}
+
+	file, err := os.Open(path)
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+
+	for line := 1; scanner.Scan(); line++ {
+		str := strings.TrimSpace(scanner.Text())
+
+		if str == "" || str[0] == '#' {
+			continue
+		}
+
+		fields := strings.Fields(str)
+
+		if len(fields) != 2 {
+			return fmt.Errorf("%s:%d: expected \"subject user[:group]\"", path, line)
+		}
+
+		tmp := strings.SplitN(fields[1], ":", 2)
+		id, err := lookup_user(tmp[0])
+
+		if err != nil {
+			return fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+
+		if len(tmp) == 2 {
+			id.Gid, err = lookup_group(tmp[1])
+			if err != nil {
+				return fmt.Errorf("%s:%d: %v", path, line, err)
+			}
+		}
+
+		c.users[fields[0]] = id
+	}
+
+	return scanner.Err()
+}
+
+func lookup_user(name string) (identity, error) {
+	var u *user.User
+	var err error
+
+	if _, e := strconv.ParseUint(name, 10, 32); e == nil {
+		u, err = user.LookupId(name)
+	} else {
+		u, err = user.Lookup(name)
+	}
+
+	if err != nil {
+		return identity{}, err
+	}
+
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+
+	if err != nil {
+		return identity{}, err
+	}
+
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+
+	if err != nil {
+		return identity{}, err
+	}
+
+	return identity{u.Username, uint32(uid), uint32(gid)}, nil
+}
+
+func lookup_group(name string) (uint32, error) {
+	if gid, err := strconv.ParseUint(name, 10, 32); err == nil {
+		return uint32(gid), nil
+	}
+
+	g, err := user.LookupGroup(name)
+
+	if err != nil {
+		return 0, err
+	}
+
+	gid, err := strconv.ParseUint(g.Gid, 10, 32)
+
+	return uint32(gid), err
+}
+
+func (c *identity_config) Subject(cert *x509.Certificate) string {
+	switch c.source {
+	case "cn":
+		return cert.Subject.CommonName
+	case "email":
+		if len(cert.EmailAddresses) > 0 {
+			return cert.EmailAddresses[0]
+		}
+	case "oid":
+		for _, v := range cert.Subject.Names {
+			if v.Type.Equal(c.oid) {
+				if s, ok := v.Value.(string); ok {
+					return s
+				}
+			}
+		}
+	}
+
+	return ""
+}
+
+func (c *identity_config) Get(r *http.Request) (identity, error) {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return identity{}, errors.New("no client certificate")
+	}
+
+	subject := c.Subject(r.TLS.PeerCertificates[0])
+
+	if subject == "" {
+		return identity{}, errors.New("no " + c.source + " in client certificate")
+	}
+
+	if id, ok := c.users[subject]; ok {
+		return id, nil
+	}
+
+	// only an explicit entry in the map file can give root
+
+	id, err := user.Lookup(subject)
+
+	if err != nil {
+		return identity{}, errors.New("unknown user: " + subject)
+	}
+
+	ret, err := lookup_user(id.Username)
+
+	if err != nil {
+		return identity{}, err
+	}
+
+	if ret.Uid == 0 {
+		return identity{}, errors.New("unknown user: " + subject)
+	}
+
+	return ret, nil
+}
+
+func (id identity) InGroup(gid uint32) bool {
+	if gid == id.Gid {
+		return true
+	}
+
+	u, err := user.LookupId(strconv.FormatUint(uint64(id.Uid), 10))
+
+	if err != nil {
+		return false
+	}
+
+	gids, err := u.GroupIds()
+
+	if err != nil {
+		return false
+	}
+
+	for _, g := range gids {
+		if g == strconv.FormatUint(uint64(gid), 10) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// job_identity forces the UserId of a job request to the identity of the
+// client certificate, GroupId is kept only if the user is a member.
+// In strict mode, or on update, mismatching values are rejected instead.
+
+func job_identity(w http.ResponseWriter, r *http.Request, desc *C.job_desc_msg_t, update bool) bool {
+	ident := get_config().ident
+	id, err := ident.Get(r)
+
+	if err != nil {
+		log.Println("from:", r.RemoteAddr, "request:", r.RequestURI, err)
+		http_error(w, 403, err.Error(), "")
+		return false
+	}
+
+	reject := ident.strict || update
+
+	if desc.user_id != C.NO_VAL && uint32(desc.user_id) != id.Uid && reject {
+		http_error(w, 403, "UserId does not match "+id.Name, "UserId")
+		return false
+	}
+
+	if desc.group_id != C.NO_VAL && !id.InGroup(uint32(desc.group_id)) {
+		if reject {
+			http_error(w, 403, "GroupId does not match "+id.Name, "GroupId")
+			return false
+		}
+		desc.group_id = C.NO_VAL
+	}
+
+	if update {
+		// slurmctld updates the jobs of job_id_str rather than job_id,
+		// they would escape the check of the owner
+
+		if desc.job_id_str != nil && !can_act_on_any_job(r) {
+			http_error(w, 403, "JobIdStr requires role operator, use JobId", "JobIdStr")
+			return false
+		}
+		if desc.job_id == C.NO_VAL && !can_act_on_any_job(r) {
+			http_error(w, 403, "JobId is required to update a job of "+id.Name, "JobId")
+			return false
+		}
+		return desc.job_id == C.NO_VAL || job_owner(w, r, desc.job_id)
+	}
+
+	desc.user_id = C.uint32_t(id.Uid)
+
+	if desc.group_id == C.NO_VAL {
+		desc.group_id = C.uint32_t(id.Gid)
+	}
+
+	return true
+}
+
+// can_act_on_any_job is true for operators and admins,
+// the other roles only act on their own jobs.
+
+func can_act_on_any_job(r *http.Request) bool {
+	_, have := get_config().policy.Get(r)
+	return have >= role_operator
+}
+
+// job_owner checks that job_id belongs to the client before it is
+// signaled, killed, requeued, completed or updated. Unknown jobs are
+// rejected by slurm as usual.
+
+func job_owner(w http.ResponseWriter, r *http.Request, job_id C.uint32_t) bool {
+	if can_act_on_any_job(r) {
+		return true
+	}
+
+	id, err := get_config().ident.Get(r)
+
+	if err != nil {
+		log.Println("from:", r.RemoteAddr, "request:", r.RequestURI, err)
+		http_error(w, 403, err.Error(), "")
+		return false
+	}
+
+	slres, errno := backend.LoadJob(job_id, C.SHOW_ALL)
+
+	if errno != 0 {
+		errno_error(w, r, errno)
+		return false
+	}
+
+	defer backend.Free(slres)
+
+	count := int(slres.record_count)
+	jobs := *(*[]C.job_info_t)(unsafe.Pointer(&reflect.SliceHeader{
+		Data: uintptr(unsafe.Pointer(slres.job_array)),
+		Len:  count,
+		Cap:  count,
+	}))
+
+	for i := range jobs {
+		if uint32(jobs[i].user_id) != id.Uid {
+			msg := "job " + strconv.FormatUint(uint64(job_id), 10) + " does not belong to " + id.Name
+			log.Println("from:", r.RemoteAddr, "request:", r.RequestURI, msg)
+			http_error(w, 403, "Forbidden: "+msg, "JobId")
+			return false
+		}
+	}
+
+	return true
+}
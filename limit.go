@@ -0,0 +1,101 @@
+package main
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// a bucket holds the requests a client can still make at once,
+// it is refilled at the rate of the config up to its burst.
+
+type bucket struct {
+	tokens float64
+	time   time.Time
+}
+
+var buckets = struct {
+	sync.Mutex
+	clients map[string]*bucket
+	sweep   time.Time
+}{
+	clients: make(map[string]*bucket),
+}
+
+// take_token returns 0 when subject can make a request,
+// or the time to wait for the next one.
+
+func take_token(subject string, rate float64, burst int) time.Duration {
+	buckets.Lock()
+	defer buckets.Unlock()
+
+	now := time.Now()
+	size := math.Max(float64(burst), 1)
+
+	// a bucket refilled up to its burst is no different from a new
+	// one, they are dropped from time to time to forget the clients
+	// that went away
+
+	if now.Sub(buckets.sweep) >= time.Minute {
+		for k, v := range buckets.clients {
+			if v.tokens+now.Sub(v.time).Seconds()*rate >= size {
+				delete(buckets.clients, k)
+			}
+		}
+		buckets.sweep = now
+	}
+
+	b, ok := buckets.clients[subject]
+
+	if !ok {
+		b = &bucket{tokens: size, time: now}
+		buckets.clients[subject] = b
+	}
+
+	b.tokens = math.Min(size, b.tokens+now.Sub(b.time).Seconds()*rate)
+	b.time = now
+
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / rate * float64(time.Second))
+	}
+
+	b.tokens--
+
+	return 0
+}
+
+// gate rejects the requests of the disabled endpoints and the clients
+// going over the rate limit, before anything else is done.
+
+func gate(mux *http.ServeMux, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := get_config()
+
+		if len(c.disabled) > 0 {
+			_, pattern := mux.Handler(r)
+
+			for _, path := range c.disabled {
+				if pattern == path {
+					http_error(w, 404, "Not Found: "+path+" is disabled", "")
+					return
+				}
+			}
+		}
+
+		if c.rate > 0 && r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+			subject := c.ident.Subject(r.TLS.PeerCertificates[0])
+
+			if wait := take_token(subject, c.rate, c.burst); wait > 0 {
+				log.Println("from:", r.RemoteAddr, "request:", r.RequestURI, "rate limit of", subject)
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				http_error(w, 429, "Too Many Requests", "")
+				return
+			}
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
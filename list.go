@@ -0,0 +1,425 @@
+package main
+
+/*
+#include <stdlib.h>
+#include "slurm/slurm.h"
+*/
+import "C"
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unsafe"
+)
+
+// list_param selects the records whose key matches one of the comma
+// separated values given in the query string, or one of the values
+// of the parameter given several times.
+
+type list_param struct {
+	key   string
+	match func(values []string) (func(v interface{}) bool, error)
+}
+
+var job_params = map[string]list_param{
+	"user":      {"UserId", match_user},
+	"state":     {"JobState", match_job_state},
+	"partition": {"Partition", match_item},
+	"name":      {"Name", match_regexp},
+}
+
+var node_params = map[string]list_param{
+	"name":      {"Name", match_glob},
+	"state":     {"NodeState", match_node_state},
+	"partition": {"Partitions", match_item},
+}
+
+var list_reserved = []string{"fields", "sort", "limit", "cursor"}
+
+type list_query struct {
+	filters []func(*table) bool
+	fields  []string
+	sort    []string
+	limit   int
+	cursor  int
+}
+
+type list_context struct{}
+
+func get_list(r *http.Request) *list_query {
+	ret, _ := r.Context().Value(list_context{}).(*list_query)
+	return ret
+}
+
+func match_user(values []string) (func(v interface{}) bool, error) {
+	uids := make(map[uint]bool)
+
+	for _, name := range values {
+		if uid, err := strconv.ParseUint(name, 10, 32); err == nil {
+			uids[uint(uid)] = true
+			continue
+		}
+		id, err := lookup_user(name)
+		if err != nil {
+			return nil, err
+		}
+		uids[uint(id.Uid)] = true
+	}
+
+	return func(v interface{}) bool {
+		uid, ok := v.(uint)
+		return ok && uids[uid]
+	}, nil
+}
+
+func match_job_state(values []string) (func(v interface{}) bool, error) {
+	states := make(map[uint]bool)
+
+	for _, name := range values {
+		if state, err := strconv.ParseUint(name, 10, 32); err == nil {
+			states[uint(state)] = true
+			continue
+		}
+		cname := C.CString(name)
+		state := C.slurm_job_state_num(cname)
+		C.free(unsafe.Pointer(cname))
+		if state < 0 {
+			return nil, errors.New("Unknown job state")
+		}
+		states[uint(state)] = true
+	}
+
+	return func(v interface{}) bool {
+		state, ok := v.(uint)
+		return ok && states[state&C.JOB_STATE_BASE]
+	}, nil
+}
+
+// a node matches its full state, e.g. IDLE+DRAIN, or its base state
+
+func match_node_state(values []string) (func(v interface{}) bool, error) {
+	return func(v interface{}) bool {
+		state, ok := v.(uint)
+		if !ok {
+			return false
+		}
+		full := C.GoString(C.slurm_node_state_string(C.uint32_t(state)))
+		base := C.GoString(C.slurm_node_state_string(C.uint32_t(state & C.NODE_STATE_BASE)))
+		for _, name := range values {
+			if strings.EqualFold(name, full) || strings.EqualFold(name, base) ||
+				name == strconv.Itoa(int(state&C.NODE_STATE_BASE)) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// match_item matches a value that may itself be a comma separated list,
+// like the partitions of a pending job or of a node.
+
+func match_item(values []string) (func(v interface{}) bool, error) {
+	return func(v interface{}) bool {
+		s, ok := v.(string)
+		if !ok {
+			return false
+		}
+		for _, item := range strings.Split(s, ",") {
+			for _, value := range values {
+				if item == value {
+					return true
+				}
+			}
+		}
+		return false
+	}, nil
+}
+
+func match_glob(values []string) (func(v interface{}) bool, error) {
+	for _, pattern := range values {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	return func(v interface{}) bool {
+		s, ok := v.(string)
+		if !ok {
+			return false
+		}
+		for _, pattern := range values {
+			if m, _ := path.Match(pattern, s); m {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// the regexp is not split on commas
+
+func match_regexp(values []string) (func(v interface{}) bool, error) {
+	re, err := regexp.Compile(strings.Join(values, ","))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return func(v interface{}) bool {
+		s, ok := v.(string)
+		return ok && re.MatchString(s)
+	}, nil
+}
+
+// list makes a list handler filter, sort and page its records.
+// The query keys of the list are removed before fn parses the others.
+
+func list(params map[string]list_param, fn http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if d := get_describe(r); d != nil {
+			d.params = params
+		}
+
+		query := r.URL.Query()
+		q := &list_query{}
+
+		for name, p := range params {
+			var matches []func(v interface{}) bool
+			for _, s := range query[name] {
+				if s == "" {
+					continue
+				}
+				m, err := p.match(strings.Split(s, ","))
+				if err != nil {
+					http_error(w, 400, "Bad value", name)
+					return
+				}
+				matches = append(matches, m)
+			}
+			query.Del(name)
+			if len(matches) == 0 {
+				continue
+			}
+			key := p.key
+			q.filters = append(q.filters, func(t *table) bool {
+				for _, m := range matches {
+					if m((*t)[key]) {
+						return true
+					}
+				}
+				return false
+			})
+		}
+
+		// fields and sort given several times add up,
+		// the last limit and cursor win
+
+		for _, name := range list_reserved {
+			values := query[name]
+			query.Del(name)
+			if len(values) == 0 {
+				continue
+			}
+			s := values[len(values)-1]
+			var err error
+			switch name {
+			case "fields":
+				for _, k := range strings.Split(strings.Join(values, ","), ",") {
+					if k != "" {
+						q.fields = append(q.fields, sluw_get_name(k))
+					}
+				}
+			case "sort":
+				for _, k := range strings.Split(strings.Join(values, ","), ",") {
+					if k == "" {
+						continue
+					}
+					if strings.HasPrefix(k, "-") {
+						q.sort = append(q.sort, "-"+sluw_get_name(k[1:]))
+					} else {
+						q.sort = append(q.sort, sluw_get_name(k))
+					}
+				}
+			case "limit":
+				if s != "" {
+					q.limit, err = strconv.Atoi(s)
+				}
+			case "cursor":
+				if s != "" {
+					q.cursor, err = strconv.Atoi(s)
+				}
+			}
+			if err != nil || q.limit < 0 || q.cursor < 0 {
+				http_error(w, 400, "Bad value", name)
+				return
+			}
+		}
+
+		u := *r.URL
+		u.RawQuery = query.Encode()
+
+		r = r.WithContext(context.WithValue(r.Context(), list_context{}, q))
+		r.URL = &u
+
+		fn(w, r)
+	}
+}
+
+func compare_value(a, b interface{}) int {
+	switch x := a.(type) {
+	case int:
+		if y, ok := b.(int); ok {
+			return x - y
+		}
+	case time_value:
+		if y, ok := b.(time_value); ok {
+			return compare_value(int(x), int(y))
+		}
+	case uint:
+		if y, ok := b.(uint); ok {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	case string:
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y)
+		}
+	}
+
+	// unlimited sorts after the numbers, nil last
+
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	case a == unlimited && b == unlimited:
+		return 0
+	case a == unlimited:
+		return 1
+	case b == unlimited:
+		return -1
+	}
+
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+// needs_names is true when a key to sort or select is not in t,
+// it may then be one of the names of list_names.
+
+func (q *list_query) needs_names(t *table) bool {
+	for _, k := range q.sort {
+		if _, ok := (*t)[strings.TrimPrefix(k, "-")]; !ok {
+			return true
+		}
+	}
+	for _, k := range q.fields {
+		if _, ok := (*t)[k]; !ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply returns the selected records of array, the records of the list
+// key, and the cursor of the next page, or -1. The shared records are
+// never modified.
+
+func (q *list_query) Apply(key string, array []*table) ([]*table, int) {
+	ret := make([]*table, 0, len(array))
+
+array:
+	for _, t := range array {
+		for _, f := range q.filters {
+			if !f(t) {
+				continue array
+			}
+		}
+		ret = append(ret, t)
+	}
+
+	// the names like JobStateName are only added when the records
+	// are sent, copies with them are made to sort or select on them
+
+	named := ret
+
+	if names := list_names[key]; names != nil && len(ret) > 0 && q.needs_names(ret[0]) {
+		named = make([]*table, len(ret))
+		for i, t := range ret {
+			v := make(table, len(*t)+2)
+			for k, x := range *t {
+				v[k] = x
+			}
+			names(v)
+			named[i] = &v
+		}
+	}
+
+	if len(q.sort) > 0 {
+		index := make([]int, len(ret))
+		for i := range index {
+			index[i] = i
+		}
+		sort.SliceStable(index, func(i, j int) bool {
+			a, b := named[index[i]], named[index[j]]
+			for _, k := range q.sort {
+				desc := strings.HasPrefix(k, "-")
+				k = strings.TrimPrefix(k, "-")
+				c := compare_value((*a)[k], (*b)[k])
+				if c == 0 {
+					continue
+				}
+				return (c < 0) != desc
+			}
+			return false
+		})
+		sorted := make([]*table, len(ret))
+		sorted_named := make([]*table, len(ret))
+		for i, k := range index {
+			sorted[i], sorted_named[i] = ret[k], named[k]
+		}
+		ret, named = sorted, sorted_named
+	}
+
+	next := -1
+
+	if q.cursor > 0 {
+		if q.cursor > len(ret) {
+			q.cursor = len(ret)
+		}
+		ret, named = ret[q.cursor:], named[q.cursor:]
+	}
+
+	if q.limit > 0 && q.limit < len(ret) {
+		ret, named = ret[:q.limit], named[:q.limit]
+		next = q.cursor + q.limit
+	}
+
+	if len(q.fields) > 0 {
+		for i, t := range named {
+			v := make(table, len(q.fields))
+			for _, k := range q.fields {
+				if x, ok := (*t)[k]; ok {
+					v[k] = x
+				}
+			}
+			ret[i] = &v
+		}
+	}
+
+	return ret, next
+}
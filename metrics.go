@@ -0,0 +1,481 @@
+package main
+
+/*
+#include "slurm/slurm.h"
+#include "slurm/slurm_errno.h"
+*/
+import "C"
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os/user"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+var metrics_buckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type endpoint_stat struct {
+	codes   map[int]uint64
+	buckets []uint64
+	count   uint64
+	sum     float64
+}
+
+var metrics = struct {
+	sync.Mutex
+	endpoints map[string]*endpoint_stat
+	errnos    map[int]uint64
+	collect   sync.Mutex
+	time      time.Time
+	cache     []byte
+}{
+	endpoints: make(map[string]*endpoint_stat),
+	errnos:    make(map[int]uint64),
+}
+
+func count_errno(errno C.int) {
+	metrics.Lock()
+	metrics.errnos[int(errno)]++
+	metrics.Unlock()
+}
+
+type status_writer struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *status_writer) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *status_writer) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = 200
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *status_writer) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *status_writer) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := w.ResponseWriter.(http.Hijacker)
+
+	if !ok {
+		return nil, nil, errors.New("Hijack not supported")
+	}
+
+	if w.status == 0 {
+		w.status = 101
+	}
+
+	return hj.Hijack()
+}
+
+// instrument counts requests and their latency by registered pattern,
+// so that REST resources do not make one serie per name.
+
+func instrument(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, pattern := mux.Handler(r)
+
+		if pattern == "" {
+			pattern = "none"
+		}
+
+		sw := &status_writer{ResponseWriter: w}
+		start := time.Now()
+
+		mux.ServeHTTP(sw, r)
+
+		elapsed := time.Since(start).Seconds()
+
+		if sw.status == 0 {
+			sw.status = 200
+		}
+
+		if get_config().log_requests {
+			log.Println("from:", r.RemoteAddr, "request:", r.Method, r.RequestURI, "status:", sw.status, "time:", time.Since(start))
+		}
+
+		metrics.Lock()
+		defer metrics.Unlock()
+
+		stat, ok := metrics.endpoints[pattern]
+
+		if !ok {
+			stat = &endpoint_stat{
+				codes:   make(map[int]uint64),
+				buckets: make([]uint64, len(metrics_buckets)),
+			}
+			metrics.endpoints[pattern] = stat
+		}
+
+		stat.codes[sw.status]++
+		stat.count++
+		stat.sum += elapsed
+
+		for i, le := range metrics_buckets {
+			if elapsed <= le {
+				stat.buckets[i]++
+			}
+		}
+	})
+}
+
+var label_escape = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func label(s string) string {
+	return `"` + label_escape.Replace(s) + `"`
+}
+
+type metric_family struct {
+	name   string
+	help   string
+	kind   string
+	values map[string]float64
+}
+
+func (m *metric_family) Add(labels string, v float64) {
+	if m.values == nil {
+		m.values = make(map[string]float64)
+	}
+	m.values[labels] += v
+}
+
+func (m *metric_family) Print(b *bytes.Buffer) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+
+	keys := make([]string, 0, len(m.values))
+
+	for k := range m.values {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if k == "" {
+			fmt.Fprintf(b, "%s %v\n", m.name, m.values[k])
+		} else {
+			fmt.Fprintf(b, "%s{%s} %v\n", m.name, k, m.values[k])
+		}
+	}
+}
+
+type user_cache map[C.uint32_t]string
+
+func (t user_cache) Get(uid C.uint32_t) string {
+	if name, ok := t[uid]; ok {
+		return name
+	}
+
+	name := strconv.Itoa(int(uid))
+
+	if u, err := user.LookupId(name); err == nil {
+		name = u.Username
+	}
+
+	t[uid] = name
+
+	return name
+}
+
+func collect_nodes(b *bytes.Buffer) bool {
+	slres, errno := backend.LoadNode(0, 0)
+
+	if errno != 0 {
+		count_errno(errno)
+		return false
+	}
+
+	count := int(slres.record_count)
+	carray := *(*[]C.node_info_t)(unsafe.Pointer(&reflect.SliceHeader{
+		Data: uintptr(unsafe.Pointer(slres.node_array)),
+		Len:  count,
+		Cap:  count,
+	}))
+
+	nodes := metric_family{name: "slurm_nodes", help: "Number of nodes by state.", kind: "gauge"}
+	cpus := metric_family{name: "slurm_node_cpus", help: "Number of CPUs by node state.", kind: "gauge"}
+
+	for i := 0; i < count; i++ {
+		state := strings.ToLower(C.GoString(C.slurm_node_state_string(carray[i].node_state)))
+		nodes.Add("state="+label(state), 1)
+		cpus.Add("state="+label(state), float64(carray[i].cpus))
+	}
+
+	backend.Free(slres)
+
+	nodes.Print(b)
+	cpus.Print(b)
+
+	return true
+}
+
+func collect_jobs(b *bytes.Buffer) bool {
+	slres, errno := backend.LoadJobs(0, 0)
+
+	if errno != 0 {
+		count_errno(errno)
+		return false
+	}
+
+	count := int(slres.record_count)
+	carray := *(*[]C.job_info_t)(unsafe.Pointer(&reflect.SliceHeader{
+		Data: uintptr(unsafe.Pointer(slres.job_array)),
+		Len:  count,
+		Cap:  count,
+	}))
+
+	jobs := metric_family{name: "slurm_jobs", help: "Number of jobs by state, partition and user.", kind: "gauge"}
+	cpus := metric_family{name: "slurm_job_cpus", help: "Number of CPUs of jobs by state, partition and user.", kind: "gauge"}
+	users := make(user_cache)
+
+	for i := 0; i < count; i++ {
+		job := &carray[i]
+		state := strings.ToLower(C.GoString(C.slurm_job_state_string(job.job_state & C.JOB_STATE_BASE)))
+		labels := "state=" + label(state) +
+			",partition=" + label(C.GoString(job.partition)) +
+			",user=" + label(users.Get(job.user_id))
+		jobs.Add(labels, 1)
+		cpus.Add(labels, float64(job.num_cpus))
+	}
+
+	backend.Free(slres)
+
+	jobs.Print(b)
+	cpus.Print(b)
+
+	return true
+}
+
+func collect_licenses(b *bytes.Buffer) bool {
+	slres, errno := backend.LoadLicenses(0, 0)
+
+	if errno != 0 {
+		count_errno(errno)
+		return false
+	}
+
+	count := int(slres.num_lic)
+	carray := *(*[]C.slurm_license_info_t)(unsafe.Pointer(&reflect.SliceHeader{
+		Data: uintptr(unsafe.Pointer(slres.lic_array)),
+		Len:  count,
+		Cap:  count,
+	}))
+
+	total := metric_family{name: "slurm_license_total", help: "Total number of licenses.", kind: "gauge"}
+	used := metric_family{name: "slurm_license_used", help: "Number of licenses in use.", kind: "gauge"}
+
+	for i := 0; i < count; i++ {
+		name := "license=" + label(C.GoString(carray[i].name))
+		total.Add(name, float64(carray[i].total))
+		used.Add(name, float64(carray[i].in_use))
+	}
+
+	backend.Free(slres)
+
+	total.Print(b)
+	used.Print(b)
+
+	return true
+}
+
+func collect_partitions(b *bytes.Buffer) bool {
+	slres, errno := backend.LoadPartitions(0, 0)
+
+	if errno != 0 {
+		count_errno(errno)
+		return false
+	}
+
+	count := int(slres.record_count)
+	carray := *(*[]C.partition_info_t)(unsafe.Pointer(&reflect.SliceHeader{
+		Data: uintptr(unsafe.Pointer(slres.partition_array)),
+		Len:  count,
+		Cap:  count,
+	}))
+
+	cpus := metric_family{name: "slurm_partition_cpus", help: "Total number of CPUs of a partition.", kind: "gauge"}
+	nodes := metric_family{name: "slurm_partition_nodes", help: "Total number of nodes of a partition.", kind: "gauge"}
+
+	for i := 0; i < count; i++ {
+		name := "partition=" + label(C.GoString(carray[i].name))
+		cpus.Add(name, float64(carray[i].total_cpus))
+		nodes.Add(name, float64(carray[i].total_nodes))
+	}
+
+	backend.Free(slres)
+
+	cpus.Print(b)
+	nodes.Print(b)
+
+	return true
+}
+
+func collect_statistics(b *bytes.Buffer) bool {
+	slreq := C.stats_info_request_msg_t{
+		command_id: C.STAT_COMMAND_GET,
+	}
+
+	slres, errno := backend.GetStatistics(&slreq)
+
+	if errno != 0 {
+		count_errno(errno)
+		return false
+	}
+
+	gauge := func(name, help string, v float64) {
+		m := metric_family{name: "slurmctld_" + name, help: help, kind: "gauge"}
+		m.Add("", v)
+		m.Print(b)
+	}
+
+	counter := func(name, help string, v float64) {
+		m := metric_family{name: "slurmctld_" + name + "_total", help: help, kind: "counter"}
+		m.Add("", v)
+		m.Print(b)
+	}
+
+	gauge("server_threads", "Number of active server threads.", float64(slres.server_thread_count))
+	gauge("agent_queue_size", "Number of outgoing RPC queued.", float64(slres.agent_queue_size))
+	gauge("dbd_agent_queue_size", "Number of messages queued for slurmdbd.", float64(slres.dbd_agent_queue_size))
+	gauge("schedule_cycle_last_microseconds", "Duration of the last scheduling cycle.", float64(slres.schedule_cycle_last))
+	gauge("schedule_cycle_max_microseconds", "Longest scheduling cycle.", float64(slres.schedule_cycle_max))
+	counter("schedule_cycle_sum_microseconds", "Total duration of the scheduling cycles.", float64(slres.schedule_cycle_sum))
+	counter("schedule_cycles", "Number of scheduling cycles.", float64(slres.schedule_cycle_counter))
+	gauge("schedule_queue_length", "Length of the last scheduling queue.", float64(slres.schedule_queue_len))
+	counter("jobs_submitted", "Number of jobs submitted.", float64(slres.jobs_submitted))
+	counter("jobs_started", "Number of jobs started.", float64(slres.jobs_started))
+	counter("jobs_completed", "Number of jobs completed.", float64(slres.jobs_completed))
+	counter("jobs_canceled", "Number of jobs canceled.", float64(slres.jobs_canceled))
+	counter("jobs_failed", "Number of jobs failed.", float64(slres.jobs_failed))
+	gauge("bf_active", "Whether the backfill scheduler is running.", float64(slres.bf_active))
+	counter("bf_backfilled_jobs", "Number of jobs started by backfill.", float64(slres.bf_backfilled_jobs))
+	counter("bf_cycles", "Number of backfill cycles.", float64(slres.bf_cycle_counter))
+	counter("bf_cycle_sum_microseconds", "Total duration of the backfill cycles.", float64(slres.bf_cycle_sum))
+	gauge("bf_cycle_last_microseconds", "Duration of the last backfill cycle.", float64(slres.bf_cycle_last))
+	gauge("bf_cycle_max_microseconds", "Longest backfill cycle.", float64(slres.bf_cycle_max))
+	gauge("bf_last_depth", "Number of jobs considered by the last backfill cycle.", float64(slres.bf_last_depth))
+	gauge("bf_queue_length", "Length of the last backfill queue.", float64(slres.bf_queue_len))
+
+	backend.Free(slres)
+
+	return true
+}
+
+// collect_slurm serializes the collections, concurrent scrapes
+// wait for the running one and get its result from the cache.
+
+func collect_slurm() []byte {
+	metrics.collect.Lock()
+	defer metrics.collect.Unlock()
+
+	if metrics.cache != nil && time.Since(metrics.time) < get_config().metrics_ttl {
+		return metrics.cache
+	}
+
+	var b bytes.Buffer
+	up := metric_family{name: "slurm_collector_up", help: "Whether the last collection succeeded.", kind: "gauge"}
+
+	collectors := []struct {
+		name string
+		fn   func(*bytes.Buffer) bool
+	}{
+		{"nodes", collect_nodes},
+		{"jobs", collect_jobs},
+		{"licenses", collect_licenses},
+		{"partitions", collect_partitions},
+		{"statistics", collect_statistics},
+	}
+
+	for _, c := range collectors {
+		v := 0.0
+		if c.fn(&b) {
+			v = 1
+		}
+		up.Add("collector="+label(c.name), v)
+	}
+
+	up.Print(&b)
+
+	metrics.cache = b.Bytes()
+	metrics.time = time.Now()
+
+	return metrics.cache
+}
+
+func collect_server(b *bytes.Buffer) {
+	metrics.Lock()
+	defer metrics.Unlock()
+
+	requests := metric_family{name: "slurm_https_requests_total", help: "Number of requests by endpoint and status.", kind: "counter"}
+	errnos := metric_family{name: "slurm_https_slurm_errors_total", help: "Number of errors returned by Slurm.", kind: "counter"}
+
+	for pattern, stat := range metrics.endpoints {
+		for code, n := range stat.codes {
+			requests.Add("endpoint="+label(pattern)+",code="+label(strconv.Itoa(code)), float64(n))
+		}
+	}
+
+	for errno, n := range metrics.errnos {
+		name := get_errno_info(C.int(errno)).name
+		if name == "" {
+			name = strconv.Itoa(errno)
+		}
+		errnos.Add("errno="+label(name), float64(n))
+	}
+
+	requests.Print(b)
+	errnos.Print(b)
+
+	name := "slurm_https_request_duration_seconds"
+	fmt.Fprintf(b, "# HELP %s Latency of requests by endpoint.\n# TYPE %s histogram\n", name, name)
+
+	patterns := make([]string, 0, len(metrics.endpoints))
+
+	for pattern := range metrics.endpoints {
+		patterns = append(patterns, pattern)
+	}
+
+	sort.Strings(patterns)
+
+	for _, pattern := range patterns {
+		stat := metrics.endpoints[pattern]
+		for i, le := range metrics_buckets {
+			fmt.Fprintf(b, "%s_bucket{endpoint=%s,le=\"%v\"} %d\n", name, label(pattern), le, stat.buckets[i])
+		}
+		fmt.Fprintf(b, "%s_bucket{endpoint=%s,le=\"+Inf\"} %d\n", name, label(pattern), stat.count)
+		fmt.Fprintf(b, "%s_sum{endpoint=%s} %v\n", name, label(pattern), stat.sum)
+		fmt.Fprintf(b, "%s_count{endpoint=%s} %d\n", name, label(pattern), stat.count)
+	}
+}
+
+func get_metrics(w http.ResponseWriter, r *http.Request) {
+	var b bytes.Buffer
+
+	b.Write(collect_slurm())
+	collect_server(&b)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write(b.Bytes())
+}
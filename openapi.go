@@ -0,0 +1,657 @@
+package main
+
+/*
+#include "slurm/slurm.h"
+*/
+import "C"
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// api_doc describes the response of a route: a record, a list of
+// records sent under key, or data of another content type.
+
+type api_doc struct {
+	res     reflect.Type
+	key     string
+	item    reflect.Type
+	props   table
+	content string
+}
+
+func record(v interface{}) api_doc {
+	return api_doc{res: reflect.TypeOf(v)}
+}
+
+func records(key string, msg interface{}, item interface{}) api_doc {
+	return api_doc{res: reflect.TypeOf(msg), key: key, item: reflect.TypeOf(item)}
+}
+
+func raw(content string) api_doc {
+	return api_doc{content: content}
+}
+
+var reservation_doc = api_doc{
+	res:   reflect.TypeOf(C.resv_desc_msg_t{}),
+	props: table{"Name": table{"type": "string"}},
+}
+
+var rpc_stat_schema = table{
+	"type": "object",
+	"additionalProperties": table{
+		"type": "object",
+		"properties": table{
+			"Count":       table{"type": "integer"},
+			"TotalTime":   table{"type": "integer"},
+			"AverageTime": table{"type": "integer"},
+		},
+	},
+}
+
+var statistics_doc = api_doc{
+	res: reflect.TypeOf(C.stats_info_response_msg_t{}),
+	props: table{
+		"RpcTypeId":    nil,
+		"RpcTypeCnt":   nil,
+		"RpcTypeTime":  nil,
+		"RpcUserId":    nil,
+		"RpcUserCnt":   nil,
+		"RpcUserTime":  nil,
+		"RpcTypeStats": rpc_stat_schema,
+		"RpcUserStats": rpc_stat_schema,
+	},
+}
+
+type api_route struct {
+	path string
+	role role
+	fn   http.HandlerFunc
+	doc  api_doc
+	rest rest_route
+}
+
+var api_routes []api_route
+
+func handle(path string, need role, fn http.HandlerFunc, doc api_doc) {
+	api_routes = append(api_routes, api_route{path: path, role: need, fn: fn, doc: doc})
+	http.HandleFunc(path, allow(need, fn))
+}
+
+func handle_rest(path string, route rest_route) {
+	api_routes = append(api_routes, api_route{path: path, rest: route})
+	http.Handle(path, route)
+}
+
+func has_route(path string) bool {
+	for _, route := range api_routes {
+		if route.path == path {
+			return true
+		}
+	}
+	return false
+}
+
+// a handler called with a describe_request only gives the keys
+// it accepts, Run returns before reading anything.
+
+type describe_request struct {
+	keys   object_map
+	params map[string]list_param
+}
+
+type describe_context struct{}
+
+func get_describe(r *http.Request) *describe_request {
+	ret, _ := r.Context().Value(describe_context{}).(*describe_request)
+	return ret
+}
+
+type discard_writer struct{}
+
+func (discard_writer) Header() http.Header         { return make(http.Header) }
+func (discard_writer) Write(b []byte) (int, error) { return len(b), nil }
+func (discard_writer) WriteHeader(int)             {}
+
+func describe(fn http.HandlerFunc) *describe_request {
+	ret := &describe_request{}
+	r, _ := http.NewRequest("GET", "/", nil)
+	fn(discard_writer{}, r.WithContext(context.WithValue(r.Context(), describe_context{}, ret)))
+	return ret
+}
+
+// input_schema follows Set, it returns false for the keys
+// that would be rejected as unsupported.
+
+func input_schema(o object) (table, bool) {
+	var ret []table
+
+	switch o.Type.Kind() {
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		ret = append(ret, table{
+			"type":    "integer",
+			"minimum": 0,
+			"maximum": ^uint64(0) >> (64 - 8*o.Type.Size()),
+		})
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if is_time(o.Type, o.Name) {
+			ret = append(ret, table{"type": "integer"}, table{
+				"type":        "string",
+				"description": "RFC 3339, local date or now[{+|-}count[seconds|minutes|hours|days|weeks]], today, tomorrow",
+			})
+			break
+		}
+		max := ^uint64(0) >> (65 - 8*o.Type.Size())
+		ret = append(ret, table{
+			"type":    "integer",
+			"minimum": -int64(max) - 1,
+			"maximum": max,
+		})
+	case reflect.Float32, reflect.Float64:
+		ret = append(ret, table{"type": "number"})
+	case reflect.Bool:
+		ret = append(ret, table{"type": "boolean"})
+	case reflect.Struct:
+		t := make(object_map)
+		t.Add(reflect.New(o.Type).Interface())
+		ret = append(ret, object_schema(t))
+	case reflect.Ptr:
+		elem := o.Type.Elem()
+		if elem == char_type {
+			ret = append(ret, table{"type": "string"})
+			break
+		}
+		supported := o.Count.IsValid() || terminated_arrays[o.Name] && (elem.Kind() == reflect.Uint32 ||
+			elem.Kind() == reflect.Int32 ||
+			elem.Kind() == reflect.Ptr && elem.Elem() == char_type)
+		if !supported || elem.Kind() == reflect.Struct || elem.Kind() == reflect.Ptr && elem.Elem() != char_type {
+			return nil, false
+		}
+		items, ok := input_schema(object{Type: elem})
+		if !ok {
+			return nil, false
+		}
+		ret = append(ret, table{"type": "array", "items": items, "maxItems": decode.max_array})
+	default:
+		return nil, false
+	}
+
+	if e := o.Enum; e != nil {
+		names := make([]string, 0, len(e.values))
+		for _, v := range e.values {
+			names = append(names, v.name)
+		}
+		if e.flags {
+			ret = append(ret, table{
+				"type":        "string",
+				"description": "names separated by commas: " + strings.Join(names, ", "),
+			}, table{
+				"type":  "array",
+				"items": table{"type": "string", "enum": names},
+			})
+		} else {
+			ret = append(ret, table{"type": "string", "enum": names})
+		}
+	}
+
+	if _, ok := get_sentinels(o.Type, o.Name); ok {
+		ret = append(ret, table{"type": "null"}, table{"enum": []string{unlimited, "infinite"}})
+	}
+
+	return any_of(ret), true
+}
+
+func object_schema(t object_map) table {
+	props := make(table, len(t))
+
+	for key, o := range t {
+		if s, ok := input_schema(o); ok {
+			props[key] = s
+		}
+	}
+
+	return table{
+		"type":                 "object",
+		"properties":           props,
+		"additionalProperties": false,
+	}
+}
+
+func any_of(s []table) table {
+	if len(s) == 1 {
+		return s[0]
+	}
+	return table{"anyOf": s}
+}
+
+// output_schemas follows get_res, the records are shared in the
+// components of the document, named by their C struct or by where
+// they are first found when the struct has no tag.
+
+type output_schemas struct {
+	schemas map[string]table
+	names   map[reflect.Type]string
+}
+
+func (s *output_schemas) Ref(t reflect.Type, hint string) table {
+	name, ok := s.names[t]
+
+	if !ok {
+		name = strings.TrimPrefix(t.Name(), "_Ctype_struct_")
+		if name == "" || strings.HasPrefix(name, "_") {
+			name = hint
+		} else {
+			name = sluw_get_name(name)
+		}
+		for i := 2; s.schemas[name] != nil; i++ {
+			name = hint + strconv.Itoa(i)
+		}
+		s.names[t] = name
+		s.schemas[name] = table{}
+		s.schemas[name] = s.Record(t, name)
+	}
+
+	return table{"$ref": "#/components/schemas/" + name}
+}
+
+func (s *output_schemas) Record(t reflect.Type, parent string) table {
+	props := make(table)
+	val := reflect.New(t).Elem()
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Name == "_" {
+			continue
+		}
+		name := sluw_get_name(f.Name)
+		var alt []table
+		switch f.Type.Kind() {
+		case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			alt = append(alt, table{"type": "integer", "minimum": 0})
+		case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if !is_time(f.Type, f.Name) {
+				props[name] = table{"type": "integer"}
+				continue
+			}
+			alt = append(alt, table{"type": "integer"}, table{"type": "string", "format": "date-time"})
+		case reflect.Float32, reflect.Float64:
+			props[name] = table{"type": "number"}
+			continue
+		case reflect.Bool:
+			props[name] = table{"type": "boolean"}
+			continue
+		case reflect.Struct:
+			props[name] = s.Ref(f.Type, parent+name)
+			continue
+		case reflect.Ptr:
+			if f.Type == list_type {
+				if kind, ok := list_types[f.Name]; ok {
+					props[name] = table{"type": "array", "items": list_schema(kind)}
+				}
+				continue
+			}
+			props[name] = s.Ptr(val, f, parent+name)
+			continue
+		default:
+			continue
+		}
+		if _, ok := get_sentinels(f.Type, f.Name); ok {
+			alt = append(alt, table{"type": "null"}, table{"const": unlimited})
+		}
+		props[name] = any_of(alt)
+	}
+
+	return table{"type": "object", "properties": props}
+}
+
+func (s *output_schemas) Ptr(val reflect.Value, f reflect.StructField, hint string) table {
+	elem := f.Type.Elem()
+	_, counted := get_count(val, f.Name)
+
+	switch {
+	case elem == char_type:
+		return table{"type": []string{"string", "null"}}
+	case is_bitmap(f.Type, f.Name):
+		return table{"type": []string{"string", "null"}, "description": "ranges of indexes, e.g. 0-3,7"}
+	case elem.Kind() == reflect.Struct && elem.Size() == 0:
+		return table{"type": "null"}
+	case elem.Kind() == reflect.Struct && !counted:
+		if strings.HasSuffix(f.Name, "_array") {
+			return table{"type": "null"}
+		}
+		return any_of([]table{s.Ref(elem, hint), {"type": "null"}})
+	}
+
+	if !counted {
+		switch {
+		case !terminated_arrays[f.Name]:
+			return table{"type": "null"}
+		case elem.Kind() == reflect.Ptr && elem.Elem() == char_type:
+		case elem.Kind() == reflect.Uint32:
+		case elem.Kind() == reflect.Int32:
+		default:
+			return table{"type": "null"}
+		}
+	}
+
+	var items table
+
+	switch elem.Kind() {
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		items = table{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		items = table{"type": "number"}
+	case reflect.Ptr:
+		items = table{"type": "null"}
+		if elem.Elem() == char_type {
+			items = table{"type": "string"}
+		}
+	case reflect.Struct:
+		items = s.Ref(elem, hint)
+	default:
+		items = table{"type": "null"}
+	}
+
+	return table{"type": "array", "items": items}
+}
+
+func list_schema(kind string) table {
+	switch kind {
+	case "uint32_t":
+		return table{"type": "integer", "minimum": 0}
+	}
+	return table{"type": "string"}
+}
+
+func (s *output_schemas) Response(doc api_doc, hint string, paged bool) table {
+	if doc.content != "" {
+		return table{doc.content: table{}}
+	}
+
+	var schema table
+
+	switch {
+	case doc.res == nil:
+		return nil
+	case doc.item == nil && doc.props == nil:
+		schema = s.Ref(doc.res, hint)
+	default:
+		var items table
+		if doc.item != nil {
+			items = s.Ref(doc.item, strings.TrimSuffix(strings.TrimSuffix(doc.key, "Array"), "s"))
+		}
+		schema = s.Record(doc.res, hint)
+		props := schema["properties"].(table)
+		if doc.item != nil {
+			props[doc.key] = table{"type": "array", "items": items}
+		}
+		if paged {
+			props["NextCursor"] = table{
+				"type":        "integer",
+				"description": "cursor of the next page, when limit is given",
+			}
+		}
+		for k, v := range doc.props {
+			if v == nil {
+				delete(props, k)
+				continue
+			}
+			props[k] = v
+		}
+	}
+
+	return table{"application/json": table{"schema": schema}}
+}
+
+type openapi_doc struct {
+	paths   table
+	schemas *output_schemas
+}
+
+func (d *openapi_doc) Operation(route string, method string, need role, fn http.HandlerFunc, doc api_doc, path_key string, defaults map[string]string) table {
+	id := strings.NewReplacer("/", "_", ".", "_").Replace(strings.ToLower(method) + strings.TrimSuffix(route, "/"))
+	desc := "Requires the role " + need.String() + "."
+
+	if need == role_none {
+		desc = "Open to any client with a certificate."
+	}
+
+	op := table{
+		"operationId": id,
+		"description": desc,
+		"x-role":      need.String(),
+		"parameters": []table{
+			{"$ref": "#/components/parameters/names"},
+			{"$ref": "#/components/parameters/times"},
+		},
+	}
+
+	responses := table{
+		"default": table{"$ref": "#/components/responses/Error"},
+	}
+
+	req := &describe_request{}
+
+	if doc.content == "" {
+		req = describe(fn)
+	}
+
+	ok := table{"description": "Done"}
+	hint := sluw_get_name(strings.Replace(strings.Trim(route, "/"), "/", "_", -1))
+
+	if content := d.schemas.Response(doc, hint, req.params != nil); content != nil {
+		ok["content"] = content
+	}
+
+	responses["200"] = ok
+	op["responses"] = responses
+
+	params := op["parameters"].([]table)
+
+	if strings.HasSuffix(route, "/") {
+		desc := "name of the record"
+		if path_key != "" {
+			desc = "sets the key " + path_key
+		}
+		params = append(params, table{
+			"name":        "name",
+			"in":          "path",
+			"required":    true,
+			"description": desc,
+			"schema":      table{"type": "string"},
+		})
+	}
+
+	if doc.content != "" {
+		op["parameters"] = params
+		return op
+	}
+
+	for _, name := range sorted_keys(req.params) {
+		params = append(params, table{
+			"name":        name,
+			"in":          "query",
+			"description": "comma separated values of " + req.params[name].key,
+			"schema":      table{"type": "string"},
+		})
+	}
+
+	if req.params != nil {
+		for _, name := range list_reserved {
+			params = append(params, table{"$ref": "#/components/parameters/" + name})
+		}
+	}
+
+	keys := make(object_map)
+
+	for k, v := range req.keys {
+		if k != path_key {
+			keys[k] = v
+		}
+	}
+
+	if _, ok := keys["UpdateTime"]; ok {
+		responses["304"] = table{"description": "Not modified since If-None-Match or If-Modified-Since"}
+	}
+
+	if method == "GET" {
+		for _, key := range sorted_keys(keys) {
+			s, ok := input_schema(keys[key])
+			if !ok {
+				continue
+			}
+			if v, ok := defaults[key]; ok {
+				s = table{"allOf": []table{s}, "default": v}
+			}
+			params = append(params, table{
+				"name":   key,
+				"in":     "query",
+				"schema": s,
+			})
+		}
+		op["parameters"] = params
+		return op
+	}
+
+	body := object_schema(keys)
+
+	for k, v := range defaults {
+		if s, ok := body["properties"].(table)[k]; ok {
+			body["properties"].(table)[k] = table{"allOf": []table{s.(table)}, "default": v}
+		}
+	}
+
+	op["parameters"] = params
+	op["requestBody"] = table{
+		"content": table{"application/json": table{"schema": body}},
+	}
+
+	return op
+}
+
+func sorted_keys(m interface{}) []string {
+	v := reflect.ValueOf(m)
+	ret := make([]string, 0, v.Len())
+
+	for _, k := range v.MapKeys() {
+		ret = append(ret, k.String())
+	}
+
+	sort.Strings(ret)
+
+	return ret
+}
+
+var openapi []byte
+
+// openapi_init describes the routes registered with handle and
+// handle_rest, the routes of a reader use GET, the others POST.
+
+func openapi_init() error {
+	d := &openapi_doc{
+		paths: make(table),
+		schemas: &output_schemas{
+			schemas: make(map[string]table),
+			names:   make(map[reflect.Type]string),
+		},
+	}
+
+	for _, route := range api_routes {
+		if route.rest == nil {
+			method := "POST"
+			if route.role <= role_readonly {
+				method = "GET"
+			}
+			d.paths[route.path] = table{
+				strings.ToLower(method): d.Operation(route.path, method, route.role, route.fn, route.doc, "", nil),
+			}
+			continue
+		}
+		ops := make(table)
+		for _, method := range sorted_keys(map[string]rest_method(route.rest)) {
+			m := route.rest[method]
+			ops[strings.ToLower(method)] = d.Operation(route.path, method, m.Role, m.Fn, m.Doc, m.Key, m.Defaults)
+		}
+		d.paths[route.path+"{name}"] = ops
+	}
+
+	d.schemas.schemas["Error"] = table{
+		"type":     "object",
+		"required": []string{"Status", "Message"},
+		"properties": table{
+			"Status":  table{"type": "integer"},
+			"Errno":   table{"type": "integer", "description": "slurm error number"},
+			"Name":    table{"type": "string", "description": "slurm error name"},
+			"Message": table{"type": "string"},
+			"Key":     table{"type": "string", "description": "the key of the request in error"},
+		},
+	}
+
+	spec := table{
+		"openapi": "3.1.0",
+		"info": table{
+			"title":   "slurm-https",
+			"version": "1",
+			"description": "Keys are given in the query string or in a JSON object, " +
+				"any method is accepted by the routes that are not REST resources.",
+		},
+		"security": []table{{"mtls": []string{}}},
+		"paths":    d.paths,
+		"components": table{
+			"schemas": d.schemas.schemas,
+			"securitySchemes": table{
+				"mtls": table{"type": "mutualTLS"},
+			},
+			"responses": table{
+				"Error": table{
+					"description": "Error",
+					"content": table{"application/json": table{
+						"schema": table{"$ref": "#/components/schemas/Error"},
+					}},
+				},
+			},
+			"parameters": table{
+				"names":  query_param("names", "add the symbolic names of the states, flags and reasons", table{"type": "boolean"}),
+				"times":  query_param("times", "format of the times", table{"enum": []string{"unix", "rfc3339"}}),
+				"fields": query_param("fields", "comma separated keys of the records to send", table{"type": "string"}),
+				"sort":   query_param("sort", "comma separated keys to sort the records by, - to reverse", table{"type": "string"}),
+				"limit":  query_param("limit", "maximum number of records to send", table{"type": "integer", "minimum": 0}),
+				"cursor": query_param("cursor", "index of the first record to send", table{"type": "integer", "minimum": 0}),
+			},
+		},
+	}
+
+	var err error
+
+	openapi, err = json.Marshal(spec)
+
+	if err != nil {
+		return err
+	}
+
+	log.Println("OpenAPI:", len(api_routes), "routes described")
+
+	return nil
+}
+
+func query_param(name string, desc string, schema table) table {
+	return table{
+		"name":        name,
+		"in":          "query",
+		"description": desc,
+		"schema":      schema,
+	}
+}
+
+func get_openapi(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openapi)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+)
+
+// output_options change how the responses are encoded,
+// they are given in the query string of any endpoint.
+
+type output_options struct {
+	names bool
+	times bool
+}
+
+type output_context struct{}
+
+func get_output(r *http.Request) *output_options {
+	ret, _ := r.Context().Value(output_context{}).(*output_options)
+
+	if ret == nil {
+		return &output_options{}
+	}
+
+	return ret
+}
+
+func output(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		opt := &output_options{}
+
+		if s, ok := query["names"]; ok {
+			v, err := strconv.ParseBool(s[len(s)-1])
+			if err != nil {
+				http_error(w, 400, "Bad value", "names")
+				return
+			}
+			opt.names = v
+			query.Del("names")
+		}
+
+		if s, ok := query["times"]; ok {
+			switch s[len(s)-1] {
+			case "unix":
+			case "rfc3339":
+				opt.times = true
+			default:
+				http_error(w, 400, "Bad value", "times")
+				return
+			}
+			query.Del("times")
+		}
+
+		u := *r.URL
+		u.RawQuery = query.Encode()
+
+		r = r.WithContext(context.WithValue(r.Context(), output_context{}, opt))
+		r.URL = &u
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Format returns a copy of the record t of the list key changed
+// by the options, the shared records are never modified.
+
+func (opt *output_options) Format(key string, t *table) *table {
+	names := list_names[key]
+
+	if !opt.times && (!opt.names || names == nil) {
+		return t
+	}
+
+	ret := make(table, len(*t)+2)
+
+	for k, v := range *t {
+		if opt.times {
+			v = format_times(v)
+		}
+		ret[k] = v
+	}
+
+	if opt.names && names != nil {
+		names(ret)
+	}
+
+	return &ret
+}
+
+// format_times returns v with its times formatted, down to the nested
+// records and arrays, which are copied as they are shared too.
+
+func format_times(v interface{}) interface{} {
+	switch x := v.(type) {
+	case time_value:
+		return x.Format()
+	case *table:
+		ret := make(table, len(*x))
+		for k, e := range *x {
+			ret[k] = format_times(e)
+		}
+		return &ret
+	case []*table:
+		ret := make([]*table, len(x))
+		for i, e := range x {
+			ret[i] = format_times(e).(*table)
+		}
+		return ret
+	case []interface{}:
+		ret := make([]interface{}, len(x))
+		for i, e := range x {
+			ret[i] = format_times(e)
+		}
+		return ret
+	}
+
+	return v
+}
+
+func (opt *output_options) FormatArray(key string, array []*table) []*table {
+	if !opt.times && !opt.names {
+		return array
+	}
+
+	ret := make([]*table, len(array))
+
+	for i, t := range array {
+		ret[i] = opt.Format(key, t)
+	}
+
+	return ret
+}
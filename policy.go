@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+type role int
+
+const (
+	role_none role = iota
+	role_readonly
+	role_user
+	role_operator
+	role_admin
+)
+
+var role_names = []string{"none", "read-only", "user", "operator", "admin"}
+
+func (r role) String() string {
+	return role_names[r]
+}
+
+func get_role(s string) (role, error) {
+	for i, name := range role_names {
+		if s == name {
+			return role(i), nil
+		}
+	}
+
+	return role_none, errors.New("unknown role: " + s)
+}
+
+type policy_config struct {
+	roles    map[string]role
+	fallback role
+}
+
+// the policy file has one "subject role" entry per line, subjects are
+// read like -ident and the subject "*" sets the role of everyone else.
+
+func (p *policy_config) Load(path string) error {
+	p.roles = make(map[string]role)
+	p.fallback = role_user
+
+	if path == "" {
+		return nil
+	}
+
+	file, err := os.Open(path)
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+
+	for line := 1; scanner.Scan(); line++ {
+		str := strings.TrimSpace(scanner.Text())
+
+		if str == "" || str[0] == '#' {
+			continue
+		}
+
+		fields := strings.Fields(str)
+
+		if len(fields) != 2 {
+			return fmt.Errorf("%s:%d: expected \"subject role\"", path, line)
+		}
+
+		r, err := get_role(fields[1])
+
+		if err != nil {
+			return fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+
+		if fields[0] == "*" {
+			p.fallback = r
+		} else {
+			p.roles[fields[0]] = r
+		}
+	}
+
+	return scanner.Err()
+}
+
+func (p *policy_config) Get(r *http.Request) (string, role) {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return "", role_none
+	}
+
+	subject := get_config().ident.Subject(r.TLS.PeerCertificates[0])
+
+	if ret, ok := p.roles[subject]; ok {
+		return subject, ret
+	}
+
+	return subject, p.fallback
+}
+
+func allow(need role, fn http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		subject, have := get_config().policy.Get(r)
+
+		if have < need {
+			msg := r.URL.Path + " requires role " + need.String() +
+				", " + subject + " has role " + have.String()
+			log.Println("from:", r.RemoteAddr, "request:", r.RequestURI, msg)
+			http_error(w, 403, "Forbidden: "+msg, "")
+			return
+		}
+
+		fn(w, r)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// rest_method maps an HTTP method of a resource to an existing handler.
+// The name of the resource is given to the handler as the key Key,
+// Doc describes the response for /openapi.json.
+
+type rest_method struct {
+	Role     role
+	Fn       http.HandlerFunc
+	Key      string
+	Defaults map[string]string
+	Doc      api_doc
+}
+
+type rest_route map[string]rest_method
+
+type rest_request struct {
+	name     string
+	params   map[string]string
+	defaults map[string]string
+	match    string
+}
+
+type rest_context struct{}
+
+func get_rest(r *http.Request) *rest_request {
+	ret, _ := r.Context().Value(rest_context{}).(*rest_request)
+	return ret
+}
+
+func (t rest_route) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	name := ""
+
+	if i := strings.Index(path, "/"); i >= 0 {
+		name = path[i+1:]
+	}
+
+	if name == "" || strings.Contains(name, "/") {
+		http_error(w, 404, "Not found", "")
+		return
+	}
+
+	m, ok := t[r.Method]
+
+	if !ok {
+		methods := make([]string, 0, len(t))
+		for k := range t {
+			methods = append(methods, k)
+		}
+		sort.Strings(methods)
+		w.Header().Set("Allow", strings.Join(methods, ", "))
+		http_error(w, 405, "Method not allowed", "")
+		return
+	}
+
+	req := &rest_request{
+		name:     name,
+		params:   make(map[string]string),
+		defaults: m.Defaults,
+	}
+
+	if m.Key != "" {
+		req.params[m.Key] = name
+	}
+
+	ctx := context.WithValue(r.Context(), rest_context{}, req)
+	allow(m.Role, m.Fn)(w, r.WithContext(ctx))
+}
+
+// match makes a list handler send only the record whose key
+// is the name of the REST resource.
+
+func match(key string, fn http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if req := get_rest(r); req != nil {
+			req.match = key
+		}
+		fn(w, r)
+	}
+}
+
+// send_array sends a loaded list of records, or only the record
+// selected by the path of a REST request, or those selected by list.
+
+func send_array(w http.ResponseWriter, r *http.Request, res *table, key string, array []*table) {
+	w.Header().Set("Content-Type", "application/json")
+	set_last_modified(w, r, res)
+
+	if req := get_rest(r); req != nil && req.match != "" {
+		for _, v := range array {
+			if fmt.Sprint((*v)[req.match]) == req.name {
+				json.NewEncoder(w).Encode(get_output(r).Format(key, v))
+				return
+			}
+		}
+		http_error(w, 404, "Not found", req.match)
+		return
+	}
+
+	ret := make(table, len(*res)+2)
+
+	for k, v := range *res {
+		ret[k] = v
+	}
+
+	if q := get_list(r); q != nil {
+		var next int
+		array, next = q.Apply(key, array)
+		ret["RecordCount"] = uint(len(array))
+		if next >= 0 {
+			ret["NextCursor"] = next
+		}
+	}
+
+	ret[key] = get_output(r).FormatArray(key, array)
+
+	json.NewEncoder(w).Encode(get_output(r).Format("", &ret))
+}
@@ -0,0 +1,89 @@
+package main
+
+/*
+#include "slurm/slurm.h"
+*/
+import "C"
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// slurm marks unset and unlimited values with the highest values
+// of each integer type, they are sent as null and "unlimited".
+
+type sentinel struct {
+	no_val   uint64
+	infinite uint64
+}
+
+var sentinels = map[uintptr]sentinel{
+	1: {C.NO_VAL8, C.INFINITE8},
+	2: {C.NO_VAL16, C.INFINITE16},
+	4: {C.NO_VAL, C.INFINITE},
+	8: {C.NO_VAL64, C.INFINITE64},
+}
+
+const unlimited = "unlimited"
+
+// time_t fields use the 32 bits values
+
+func get_sentinels(t reflect.Type, name string) (sentinel, bool) {
+	switch t.Kind() {
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		s, ok := sentinels[t.Size()]
+		return s, ok
+	}
+
+	if is_time(t, name) {
+		return sentinels[4], true
+	}
+
+	return sentinel{}, false
+}
+
+func get_sentinel(t reflect.Type, name string, value uint64) (interface{}, bool) {
+	s, ok := get_sentinels(t, name)
+
+	switch {
+	case !ok:
+		return nil, false
+	case value == s.no_val:
+		return nil, true
+	case value == s.infinite:
+		return unlimited, true
+	}
+
+	return nil, false
+}
+
+// parse_sentinel replaces null and "unlimited" by their value,
+// a JSON null is decoded as a nil value.
+
+func parse_sentinel(t reflect.Type, name string, value *json.RawMessage) (json.RawMessage, bool) {
+	s, ok := get_sentinels(t, name)
+
+	if !ok {
+		return nil, false
+	}
+
+	if value == nil || string(*value) == "null" {
+		return json.RawMessage(strconv.FormatUint(s.no_val, 10)), true
+	}
+
+	var str string
+
+	if json.Unmarshal(*value, &str) != nil {
+		return nil, false
+	}
+
+	switch strings.ToLower(str) {
+	case unlimited, "infinite":
+		return json.RawMessage(strconv.FormatUint(s.infinite, 10)), true
+	}
+
+	return nil, false
+}
@@ -26,24 +26,34 @@ import (
 )
 
 import (
-	"crypto/tls"
-	"crypto/x509"
+	"bytes"
 	"encoding/json"
+	"errors"
 	"flag"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"os/user"
 	"reflect"
 	"strconv"
 	"strings"
+	"syscall"
 	"unsafe"
 )
 
-func slurm_error(w http.ResponseWriter, r *http.Request) {
-	errno := C.slurm_get_errno()
+func errno_error(w http.ResponseWriter, r *http.Request, errno C.int) {
 	errno_str := "SLURM-" + strconv.Itoa(int(errno)) + " " + C.GoString(C.slurm_strerror(errno))
 	log.Println("from:", r.RemoteAddr, "request:", r.RequestURI, errno_str)
-	http.Error(w, errno_str, 500)
+	count_errno(errno)
+	info := get_errno_info(errno)
+	send_error(w, &api_error{
+		Status:  info.status,
+		Errno:   int(errno),
+		Name:    info.name,
+		Message: C.GoString(C.slurm_strerror(errno)),
+	})
 }
 
 func sluw_get_name(s string) string {
@@ -63,8 +73,11 @@ func sluw_get_name(s string) string {
 }
 
 type object struct {
-	Type   string
+	Name   string
+	Type   reflect.Type
 	Offset unsafe.Pointer
+	Enum   *enum
+	Count  reflect.Value
 }
 
 type object_map map[string]object
@@ -84,6 +97,11 @@ func (t object_map) Add(data interface{}) {
 
 	ptr := val.Addr().Pointer()
 
+	// the count of an array is only set from its length,
+	// a client giving it could make it point past the end
+
+	var counts []string
+
 	for i := 0; i < val.NumField(); i++ {
 		name := val.Type().Field(i).Name
 		offset := val.Type().Field(i).Offset
@@ -91,111 +109,380 @@ func (t object_map) Add(data interface{}) {
 		if name == "_" {
 			continue
 		}
+		count := get_count_field(val, name)
+		if count.IsValid() {
+			if field.Kind() == reflect.Ptr && field.Type().Elem() != char_type {
+				counts = append(counts, get_count_name(val, name))
+			}
+			count = reflect.NewAt(count.Type(), unsafe.Pointer(count.UnsafeAddr())).Elem()
+		}
 		t[sluw_get_name(name)] = object{
-			field.Type().String(),
+			name,
+			field.Type(),
 			unsafe.Pointer(ptr + offset),
+			get_enum(val.Type(), sluw_get_name(name)),
+			count,
 		}
 	}
+
+	for _, name := range counts {
+		delete(t, sluw_get_name(name))
+	}
 }
 
 func (t object_map) Run(w http.ResponseWriter, r *http.Request, fn func()) {
-	var req map[string]*json.RawMessage
-	err := json.NewDecoder(r.Body).Decode(&req)
+	if d := get_describe(r); d != nil {
+		d.keys = t
+		return
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, get_config().max_body))
+
+	if err != nil {
+		http_error(w, 413, "Request too large", "")
+		return
+	}
+
+	req := make(map[string]*json.RawMessage)
+
+	if len(bytes.TrimSpace(body)) > 0 {
+		req, err = decode_object(body)
+	}
+
+	if e, ok := err.(*duplicate_error); ok {
+		http_error(w, 400, "Duplicate key", e.key)
+		return
+	}
 
 	if err != nil {
-		http.Error(w, "Bad request", 400)
+		http_error(w, 400, "Bad request", "")
 		return
 	}
 
+	// keys may also be given in the query string or by a REST path,
+	// but only once
+
+	params := make(map[string]string)
+
+	for k, v := range r.URL.Query() {
+		key := sluw_get_name(k)
+		if _, ok := params[key]; ok || len(v) > 1 || req[key] != nil {
+			http_error(w, 400, "Duplicate key", key)
+			return
+		}
+		params[key] = v[0]
+	}
+
+	if rest := get_rest(r); rest != nil {
+		for k, v := range rest.params {
+			if _, ok := params[k]; ok || req[k] != nil {
+				http_error(w, 400, "Duplicate key", k)
+				return
+			}
+			params[k] = v
+		}
+		for k, v := range rest.defaults {
+			if _, ok := params[k]; !ok && req[k] == nil {
+				params[k] = v
+			}
+		}
+	}
+
+	for key, value := range params {
+		dst, ok := t[key]
+
+		if !ok {
+			http_error(w, 400, "Unknown key", key)
+			return
+		}
+
+		tmp := json.RawMessage(value)
+
+		if dst.Type == reflect.TypeOf((*C.char)(nil)) || !json.Valid(tmp) {
+			tmp, _ = json.Marshal(value)
+		}
+
+		req[key] = &tmp
+	}
+
+	mem := &arena{}
+	defer mem.Free()
+
 	for key, value := range req {
 		dst, ok := t[key]
 
 		if !ok {
-			http.Error(w, "Unknown key: "+key, 400)
+			http_error(w, 400, "Unknown key", key)
 			return
 		}
 
-		var err error
+		err := dst.Set(value, mem)
 
-		switch dst.Type {
-		case "*main._Ctype_char":
-			var s string
-			err = json.Unmarshal(*value, &s)
-			tmp := C.CString(s)
-			*(**C.char)(dst.Offset) = tmp
-			defer C.free(unsafe.Pointer(tmp))
-		case "main._Ctype_uint32_t":
-			var i uint32
-			err = json.Unmarshal(*value, &i)
-			*(*C.uint32_t)(dst.Offset) = C.uint32_t(i)
-		case "main._Ctype_uint16_t":
-			var i uint16
-			err = json.Unmarshal(*value, &i)
-			*(*C.uint16_t)(dst.Offset) = C.uint16_t(i)
-		case "main._Ctype_uint8_t":
-			var i uint8
-			err = json.Unmarshal(*value, &i)
-			*(*C.uint8_t)(dst.Offset) = C.uint8_t(i)
-		case "main._Ctype_int32_t":
-			var i int32
-			err = json.Unmarshal(*value, &i)
-			*(*C.int32_t)(dst.Offset) = C.int32_t(i)
-		case "main._Ctype_int16_t":
-			var i int16
-			err = json.Unmarshal(*value, &i)
-			*(*C.int16_t)(dst.Offset) = C.int16_t(i)
-		case "main._Ctype_int8_t":
-			var i int8
-			err = json.Unmarshal(*value, &i)
-			*(*C.int8_t)(dst.Offset) = C.int8_t(i)
-		case "main._Ctype_time_t":
-			var i uint64
+		if err == err_unsupported {
+			http_error(w, 400, "Unsupported key", key)
+			return
+		}
+
+		if err != nil {
+			http_error(w, 400, "Bad value", key)
+			return
+		}
+	}
+
+	fn()
+}
+
+var err_unsupported = errors.New("Unsupported type")
+var err_terminator = errors.New("Terminator in array")
+
+// Set decodes value in the C field of dst, the memory allocated for
+// it is kept in mem until the request is done.
+
+func (dst object) Set(value *json.RawMessage, mem *arena) error {
+	if tmp, ok := parse_sentinel(dst.Type, dst.Name, value); ok {
+		value = &tmp
+	} else if value == nil {
+		return nil
+	}
+
+	if dst.Enum != nil {
+		tmp, err := parse_enum(dst.Enum, *value)
+		if err != nil {
+			return err
+		}
+		value = &tmp
+	}
+
+	v := reflect.NewAt(dst.Type, dst.Offset).Elem()
+
+	switch dst.Type.Kind() {
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var i uint64
+		if err := json.Unmarshal(*value, &i); err != nil {
+			return err
+		}
+		if v.OverflowUint(i) {
+			return errors.New("Overflow")
+		}
+		v.SetUint(i)
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		var err error
+		if is_time(dst.Type, dst.Name) {
+			i, err = parse_time(*value)
+		} else {
 			err = json.Unmarshal(*value, &i)
-			*(*C.time_t)(dst.Offset) = C.time_t(i)
-		case "*main._Ctype_uint32_t":
-			var ai []uint32
-			err = json.Unmarshal(*value, &ai)
-			tmp := C.sluw_alloc_uint32_t(C.int(len(ai)))
-			defer C.free(unsafe.Pointer(tmp))
-			for i := 0; i < len(ai); i++ {
-				C.sluw_set_uint32_t(tmp, C.uint32_t(ai[i]), C.int(i))
-			}
-			*(**C.uint32_t)(dst.Offset) = tmp
-		case "*main._Ctype_int32_t":
-			var ai []int32
-			err = json.Unmarshal(*value, &ai)
-			tmp := C.sluw_alloc_int32_t(C.int(len(ai)))
-			defer C.free(unsafe.Pointer(tmp))
-			for i := 0; i < len(ai); i++ {
-				C.sluw_set_int32_t(tmp, C.int32_t(ai[i]), C.int(i))
+		}
+		if err != nil {
+			return err
+		}
+		if v.OverflowInt(i) {
+			return errors.New("Overflow")
+		}
+		v.SetInt(i)
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		if err := json.Unmarshal(*value, &f); err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Bool:
+		var b bool
+		if err := json.Unmarshal(*value, &b); err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Struct:
+		req, err := decode_object(*value)
+		if err != nil {
+			return err
+		}
+		t := make(object_map)
+		t.Add(reflect.NewAt(dst.Type, dst.Offset).Interface())
+		for key, value := range req {
+			sub, ok := t[key]
+			if !ok {
+				return errors.New("Unknown key " + key)
 			}
-			*(**C.int32_t)(dst.Offset) = tmp
-		case "**main._Ctype_char":
-			var as []string
-			err = json.Unmarshal(*value, &as)
-			tmp := C.sluw_alloc_chars(C.int(len(as)))
-			defer C.free(unsafe.Pointer(tmp))
-			for i := 0; i < len(as); i++ {
-				tmp2 := C.CString(as[i])
-				defer C.free(unsafe.Pointer(tmp2))
-				C.sluw_set_chars(tmp, tmp2, C.int(i))
+			if err := sub.Set(value, mem); err != nil {
+				return err
 			}
-			*(***C.char)(dst.Offset) = (**C.char)(tmp)
-		default:
-			log.Println(key, reflect.TypeOf(dst), "not supported")
 		}
+	case reflect.Ptr:
+		return dst.SetArray(value, mem)
+	default:
+		return err_unsupported
+	}
 
+	return nil
+}
+
+// SetArray decodes strings and arrays, arrays without a count field
+// are terminated like the SLUW_LIST ones when terminated_arrays has them.
+
+func (dst object) SetArray(value *json.RawMessage, mem *arena) error {
+	elem := dst.Type.Elem()
+
+	if elem == char_type {
+		var s string
+		if err := json.Unmarshal(*value, &s); err != nil {
+			return err
+		}
+		tmp, err := mem.CString(s)
 		if err != nil {
-			http.Error(w, "Bad value for key: "+key, 400)
-			return
+			return err
 		}
+		*(**C.char)(dst.Offset) = tmp
+		return nil
 	}
 
-	fn()
+	var term interface{}
+
+	switch {
+	case dst.Count.IsValid():
+	case !terminated_arrays[dst.Name]:
+		return err_unsupported
+	case elem.Kind() == reflect.Uint32:
+		term = uint64(0)
+	case elem.Kind() == reflect.Int32:
+		term = int64(-1)
+	case elem.Kind() == reflect.Ptr && elem.Elem() == char_type:
+		term = nil
+	default:
+		return err_unsupported
+	}
+
+	if elem.Kind() == reflect.Struct || elem.Kind() == reflect.Ptr && elem.Elem() != char_type {
+		return err_unsupported
+	}
+
+	var array []json.RawMessage
+
+	if err := json.Unmarshal(*value, &array); err != nil {
+		return err
+	}
+
+	count := len(array)
+
+	if !dst.Count.IsValid() {
+		count++
+	}
+
+	data, err := mem.Calloc(count, elem.Size())
+
+	if err != nil {
+		return err
+	}
+
+	for k, v := range array {
+		e := object{
+			Type:   elem,
+			Offset: unsafe.Pointer(uintptr(data) + uintptr(k)*elem.Size()),
+		}
+		if err := e.Set(&v, mem); err != nil {
+			return err
+		}
+		// the terminator would cut the array short
+
+		x := reflect.NewAt(elem, e.Offset).Elem()
+		switch t := term.(type) {
+		case uint64:
+			if x.Uint() == t {
+				return err_terminator
+			}
+		case int64:
+			if x.Int() == t {
+				return err_terminator
+			}
+		}
+	}
+
+	if !dst.Count.IsValid() && term != nil {
+		e := reflect.NewAt(elem, unsafe.Pointer(uintptr(data)+uintptr(len(array))*elem.Size())).Elem()
+		switch t := term.(type) {
+		case uint64:
+			e.SetUint(t)
+		case int64:
+			e.SetInt(t)
+		}
+	}
+
+	if dst.Count.IsValid() {
+		switch dst.Count.Kind() {
+		case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			dst.Count.SetUint(uint64(len(array)))
+		default:
+			dst.Count.SetInt(int64(len(array)))
+		}
+	}
+
+	*(*unsafe.Pointer)(dst.Offset) = data
+
+	return nil
 }
 
 type table map[string]interface{}
 
+var (
+	char_type   = reflect.TypeOf(C.char(0))
+	time_type   = reflect.TypeOf(C.time_t(0))
+	bitstr_type = reflect.TypeOf(C.bitstr_t(0))
+	list_type   = reflect.TypeOf(C.List(nil))
+)
+
+// time_t, int64_t and bitstr_t are all a long for cgo, so the fields
+// holding a time or a bitmap are only known by their names.
+
+var time_fields = map[string]bool{
+	"begin_time":         true,
+	"bf_when_last_cycle": true,
+	"boot_time":          true,
+	"deadline":           true,
+	"eligible_time":      true,
+	"end_time":           true,
+	"job_states_ts":      true,
+	"last_sched_eval":    true,
+	"last_update":        true,
+	"preempt_time":       true,
+	"reason_time":        true,
+	"req_time":           true,
+	"req_time_start":     true,
+	"resize_time":        true,
+	"slurmd_start_time":  true,
+	"start_time":         true,
+	"submit_time":        true,
+	"suspend_time":       true,
+}
+
+var bitmap_fields = map[string]bool{
+	"array_bitmap": true,
+	"core_bitmap":  true,
+	"node_bitmap":  true,
+}
+
+func is_time(t reflect.Type, name string) bool {
+	return t == time_type && time_fields[name]
+}
+
+func is_bitmap(t reflect.Type, name string) bool {
+	return t.Kind() == reflect.Ptr && t.Elem() == bitstr_type && bitmap_fields[name]
+}
+
+// terminated_arrays names the arrays without a count field that are
+// terminated like the SLUW_LIST ones, others are not decoded.
+
+var terminated_arrays = map[string]bool{
+	"core_cnt":     true,
+	"exc_node_inx": true,
+	"node_cnt":     true,
+	"node_inx":     true,
+	"req_node_inx": true,
+}
+
+// get_res decodes a C struct by the kind of its fields, cgo types
+// are aliases of the C types they are defined with, e.g. uint32_t
+// is an unsigned int, so they can't be told apart by name.
+
 func get_res(data interface{}) *table {
 	ret := make(table)
 	val := reflect.ValueOf(data).Elem()
@@ -206,58 +493,39 @@ func get_res(data interface{}) *table {
 		}
 		name := sluw_get_name(f.Name)
 		v := val.Field(i)
-		switch f.Type.String() {
-		case "main._Ctype_uint8_t",
-			"main._Ctype_uint16_t",
-			"main._Ctype_uint32_t",
-			"main._Ctype_uint64_t":
-			ret[name] = uint(v.Uint())
-		case "main._Ctype_int8_t",
-			"main._Ctype_int16_t",
-			"main._Ctype_int32_t",
-			"main._Ctype_int64_t",
-			"main._Ctype_time_t": // why not..
-			ret[name] = int(v.Int())
-		case "*main._Ctype_uint32_t":
-			if v.Pointer() == 0 {
-				ret[name] = make([]uint, 0)
+		switch f.Type.Kind() {
+		case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if s, ok := get_sentinel(f.Type, f.Name, v.Uint()); ok {
+				ret[name] = s
 				break
 			}
-			data := unsafe.Pointer(v.Pointer())
-			count := int(C.sluw_len_uint32_t((*C.uint32_t)(data)))
-			array := make([]uint, count)
-			carray := *(*[]C.uint32_t)(unsafe.Pointer(&reflect.SliceHeader{
-				Data: uintptr(data),
-				Len:  count,
-				Cap:  count,
-			}))
-			for k := 0; k < count; k++ {
-				array[k] = uint(carray[k])
-			}
-			ret[name] = array
-		case "*main._Ctype_int32_t":
-			if v.Pointer() == 0 {
-				ret[name] = make([]int, 0)
+			ret[name] = uint(v.Uint())
+		case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if !is_time(f.Type, f.Name) {
+				ret[name] = int(v.Int())
 				break
 			}
-			data := unsafe.Pointer(v.Pointer())
-			count := int(C.sluw_len_int32_t((*C.int32_t)(data)))
-			array := make([]int, count)
-			carray := *(*[]C.int32_t)(unsafe.Pointer(&reflect.SliceHeader{
-				Data: uintptr(data),
-				Len:  count,
-				Cap:  count,
-			}))
-			for k := 0; k < count; k++ {
-				array[k] = int(carray[k])
+			if s, ok := get_sentinel(f.Type, f.Name, uint64(v.Int())); ok {
+				ret[name] = s
+				break
 			}
-			ret[name] = array
-		case "*main._Ctype_char":
-			if v.Pointer() == 0 {
-				ret[name] = nil
+			ret[name] = time_value(v.Int())
+		case reflect.Float32, reflect.Float64:
+			ret[name] = v.Float()
+		case reflect.Bool:
+			ret[name] = v.Bool()
+		case reflect.Struct:
+			ret[name] = get_res(reflect.NewAt(f.Type, unsafe.Pointer(v.UnsafeAddr())).Interface())
+		case reflect.UnsafePointer:
+			// opaque
+		case reflect.Ptr:
+			if f.Type == list_type {
+				if kind, ok := list_types[f.Name]; ok {
+					ret[name] = get_slurm_list(kind, C.List(unsafe.Pointer(v.Pointer())))
+				}
 				break
 			}
-			ret[name] = C.GoString((*C.char)(unsafe.Pointer(v.Pointer())))
+			ret[name] = get_res_ptr(val, f, v)
 		default:
 			log.Println(name, f.Type, "not supported")
 		}
@@ -266,28 +534,244 @@ func get_res(data interface{}) *table {
 	return &ret
 }
 
+// get_res_ptr decodes the arrays of known length: the ones with a
+// count field, strings and the ones of terminated_arrays.
+
+func get_res_ptr(val reflect.Value, f reflect.StructField, v reflect.Value) interface{} {
+	elem := f.Type.Elem()
+	data := unsafe.Pointer(v.Pointer())
+	count, counted := get_count(val, f.Name)
+
+	switch {
+	case elem == char_type:
+		if data == nil {
+			return nil
+		}
+		return C.GoString((*C.char)(data))
+	case is_bitmap(f.Type, f.Name):
+		if data == nil {
+			return nil
+		}
+		return get_bitmap((*C.bitstr_t)(data))
+	case elem.Kind() == reflect.Struct && elem.Size() == 0:
+		// opaque
+		return nil
+	case elem.Kind() == reflect.Struct && !counted:
+		// arrays of records counted by record_count are decoded by their handlers
+		if data == nil || strings.HasSuffix(f.Name, "_array") {
+			return nil
+		}
+		return get_res(reflect.NewAt(elem, data).Interface())
+	}
+
+	if !counted {
+		switch {
+		case !terminated_arrays[f.Name]:
+			return nil
+		case elem.Kind() == reflect.Ptr && elem.Elem() == char_type:
+			count = int(C.sluw_len_chars((*C.chars)(data)))
+		case elem.Kind() == reflect.Uint32:
+			count = int(C.sluw_len_uint32_t((*C.uint32_t)(data)))
+		case elem.Kind() == reflect.Int32:
+			count = int(C.sluw_len_int32_t((*C.int32_t)(data)))
+		default:
+			return nil
+		}
+	}
+
+	if data == nil {
+		count = 0
+	}
+
+	array := reflect.MakeSlice(reflect.SliceOf(elem), count, count)
+
+	if count > 0 {
+		reflect.Copy(array, reflect.NewAt(reflect.ArrayOf(count, elem), data).Elem())
+	}
+
+	ret := make([]interface{}, count)
+
+	for k := 0; k < count; k++ {
+		e := array.Index(k)
+		switch e.Kind() {
+		case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			ret[k] = uint(e.Uint())
+		case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			ret[k] = int(e.Int())
+		case reflect.Float32, reflect.Float64:
+			ret[k] = e.Float()
+		case reflect.Ptr:
+			if elem.Elem() == char_type {
+				ret[k] = C.GoString((*C.char)(unsafe.Pointer(e.Pointer())))
+			}
+		case reflect.Struct:
+			ret[k] = get_res(array.Index(k).Addr().Interface())
+		}
+	}
+
+	return ret
+}
+
+// array_counts names the fields counting the arrays
+// that don't follow the name_cnt, name_size or name_count pattern.
+
+var array_counts = map[string]string{
+	"argv":              "argc",
+	"environment":       "env_size",
+	"rpc_dump_hostlist": "rpc_dump_count",
+	"rpc_dump_types":    "rpc_dump_count",
+	"rpc_queue_count":   "rpc_queue_type_count",
+	"rpc_queue_type_id": "rpc_queue_type_count",
+}
+
+// get_count_name returns the name of the field of val counting
+// the elements of the array name, like gres_detail_cnt for gres_detail_str.
+
+func get_count_name(val reflect.Value, name string) string {
+	base := strings.TrimSuffix(name, "_str")
+
+	for _, s := range []string{
+		array_counts[name],
+		name + "_cnt", name + "_size", name + "_count",
+		base + "_cnt", base + "_size", base + "_count",
+	} {
+		if s == "" || s == name {
+			continue
+		}
+		switch val.FieldByName(s).Kind() {
+		case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return s
+		}
+	}
+
+	return ""
+}
+
+func get_count_field(val reflect.Value, name string) reflect.Value {
+	if s := get_count_name(val, name); s != "" {
+		return val.FieldByName(s)
+	}
+
+	return reflect.Value{}
+}
+
+func get_count(val reflect.Value, name string) (int, bool) {
+	f := get_count_field(val, name)
+
+	switch f.Kind() {
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int(f.Uint()), true
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(f.Int()), true
+	}
+
+	return 0, false
+}
+
+// get_bitmap formats a bitmap as ranges of indexes, e.g. 0-3,7
+
+func get_bitmap(b *C.bitstr_t) string {
+	size := int64(C.slurm_bit_size(b))
+	ranges := make([]string, 0)
+
+	for i := int64(0); i < size; i++ {
+		if C.slurm_bit_test(b, C.bitoff_t(i)) == 0 {
+			continue
+		}
+		j := i
+		for j+1 < size && C.slurm_bit_test(b, C.bitoff_t(j+1)) != 0 {
+			j++
+		}
+		if i == j {
+			ranges = append(ranges, strconv.FormatInt(i, 10))
+		} else {
+			ranges = append(ranges, strconv.FormatInt(i, 10)+"-"+strconv.FormatInt(j, 10))
+		}
+		i = j
+	}
+
+	return strings.Join(ranges, ",")
+}
+
+// the type of the elements of the lists, others like the
+// job_defaults_list of slurm_ctl_conf and partition_info are not decoded
+
+var list_types = map[string]string{
+	"preemptee_job_id": "uint32_t",
+}
+
+func get_slurm_list(kind string, l C.List) []interface{} {
+	ret := make([]interface{}, 0)
+
+	if l == nil {
+		return ret
+	}
+
+	it := C.slurm_list_iterator_create(l)
+
+	for {
+		data := C.slurm_list_next(it)
+		if data == nil {
+			break
+		}
+		switch kind {
+		case "uint32_t":
+			ret = append(ret, uint(*(*C.uint32_t)(data)))
+		case "char":
+			ret = append(ret, C.GoString((*C.char)(data)))
+		}
+	}
+
+	C.slurm_list_iterator_destroy(it)
+
+	return ret
+}
+
 func submit_batch_job(w http.ResponseWriter, r *http.Request) {
 	var slreq C.job_desc_msg_t
 	C.slurm_init_job_desc_msg(&slreq)
 
+	opt := struct {
+		callback_url *C.char
+	}{}
+
 	obj := make(object_map)
 	obj.Add(&slreq)
+	obj.Add(&opt)
 
 	obj.Run(w, r, func() {
-		var slres *C.submit_response_msg_t
+		if !job_identity(w, r, &slreq, false) {
+			return
+		}
 
-		ret := C.slurm_submit_batch_job(&slreq, &slres)
+		callback := ""
 
-		if ret != 0 {
-			slurm_error(w, r)
+		if opt.callback_url != nil {
+			callback = C.GoString(opt.callback_url)
+
+			if err := webhook_check(callback); err != nil {
+				http_error(w, 400, err.Error(), "CallbackUrl")
+				return
+			}
+		}
+
+		slres, errno := backend.SubmitBatchJob(&slreq)
+
+		if errno != 0 {
+			errno_error(w, r, errno)
 			return
 		}
 
+		if callback != "" {
+			webhook_track(uint32(slres.job_id), callback)
+		}
+
 		res := get_res(slres)
-		C.slurm_free_submit_response_response_msg(slres)
+		backend.Free(slres)
 
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(&res)
+		json.NewEncoder(w).Encode(get_output(r).Format("", res))
 	})
 }
 
@@ -301,10 +785,10 @@ func notify_job(w http.ResponseWriter, r *http.Request) {
 	obj.Add(&opt)
 
 	obj.Run(w, r, func() {
-		ret := C.slurm_notify_job(opt.job_id, opt.message)
+		errno := backend.NotifyJob(opt.job_id, opt.message)
 
-		if ret != 0 {
-			slurm_error(w, r)
+		if errno != 0 {
+			errno_error(w, r, errno)
 			return
 		}
 	})
@@ -318,15 +802,52 @@ func update_job(w http.ResponseWriter, r *http.Request) {
 	obj.Add(&slreq)
 
 	obj.Run(w, r, func() {
-		ret := C.slurm_update_job(&slreq)
+		if !job_identity(w, r, &slreq, true) {
+			return
+		}
+
+		errno := backend.UpdateJob(&slreq)
 
-		if ret != 0 {
-			slurm_error(w, r)
+		if errno != 0 {
+			errno_error(w, r, errno)
 			return
 		}
 	})
 }
 
+func get_job_info(slres *C.job_info_msg_t) *snapshot {
+	data := unsafe.Pointer(slres.job_array)
+	count := int(slres.record_count)
+	carray := *(*[]C.job_info_t)(unsafe.Pointer(&reflect.SliceHeader{
+		Data: uintptr(data),
+		Len:  count,
+		Cap:  count,
+	}))
+
+	res := get_res(slres)
+
+	array := make([]*table, count)
+	for i := 0; i < count; i++ {
+		array[i] = get_res(&carray[i])
+	}
+
+	snap := &snapshot{slres.last_update, res, array}
+
+	backend.Free(slres)
+
+	return snap
+}
+
+func load_jobs_snapshot(update_time C.time_t, show_flags C.uint16_t) (*snapshot, C.int) {
+	slres, errno := backend.LoadJobs(update_time, show_flags)
+
+	if errno != 0 {
+		return nil, errno
+	}
+
+	return get_job_info(slres), 0
+}
+
 func load_jobs(w http.ResponseWriter, r *http.Request) {
 	opt := struct {
 		update_time C.time_t
@@ -337,39 +858,120 @@ func load_jobs(w http.ResponseWriter, r *http.Request) {
 	obj.Add(&opt)
 
 	obj.Run(w, r, func() {
-		var slres *C.job_info_msg_t
+		if_modified(r, &opt.update_time)
 
-		ret := C.slurm_load_jobs(opt.update_time, &slres, opt.show_flags)
+		snap, errno := cache_load("jobs", load_jobs_snapshot, opt.update_time, opt.show_flags)
 
-		if ret != 0 {
-			slurm_error(w, r)
+		if errno != 0 {
+			load_error(w, r, errno, opt.update_time)
 			return
 		}
 
-		data := unsafe.Pointer(slres.job_array)
-		count := int(slres.record_count)
-		carray := *(*[]C.job_info_t)(unsafe.Pointer(&reflect.SliceHeader{
+		send_array(w, r, snap.res, "JobArray", snap.array)
+	})
+}
+
+func load_job(w http.ResponseWriter, r *http.Request) {
+	opt := struct {
+		job_id     C.uint32_t
+		show_flags C.uint16_t
+	}{}
+
+	obj := make(object_map)
+	obj.Add(&opt)
+
+	obj.Run(w, r, func() {
+		slres, errno := backend.LoadJob(opt.job_id, opt.show_flags)
+
+		if errno != 0 {
+			errno_error(w, r, errno)
+			return
+		}
+
+		snap := get_job_info(slres)
+
+		send_array(w, r, snap.res, "JobArray", snap.array)
+	})
+}
+
+func get_job_steps(w http.ResponseWriter, r *http.Request) {
+	opt := struct {
+		update_time C.time_t
+		job_id      C.uint32_t
+		step_id     C.uint32_t
+		show_flags  C.uint16_t
+	}{
+		job_id:  C.NO_VAL,
+		step_id: C.NO_VAL,
+	}
+
+	obj := make(object_map)
+	obj.Add(&opt)
+
+	obj.Run(w, r, func() {
+		if_modified(r, &opt.update_time)
+
+		slres, errno := backend.GetJobSteps(opt.update_time, opt.job_id, opt.step_id, opt.show_flags)
+
+		if errno != 0 {
+			load_error(w, r, errno, opt.update_time)
+			return
+		}
+
+		data := unsafe.Pointer(slres.job_steps)
+		count := int(slres.job_step_count)
+		carray := *(*[]C.job_step_info_t)(unsafe.Pointer(&reflect.SliceHeader{
 			Data: uintptr(data),
 			Len:  count,
 			Cap:  count,
 		}))
 
 		res := get_res(slres)
-
 		array := make([]*table, count)
+
 		for i := 0; i < count; i++ {
 			array[i] = get_res(&carray[i])
 		}
 
-		(*res)["JobArray"] = array
+		backend.Free(slres)
 
-		C.slurm_free_job_info_msg(slres)
-
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(&res)
+		send_array(w, r, res, "JobSteps", array)
 	})
 }
 
+func get_node_info(slres *C.node_info_msg_t) *snapshot {
+	data := unsafe.Pointer(slres.node_array)
+	count := int(slres.record_count)
+	carray := *(*[]C.node_info_t)(unsafe.Pointer(&reflect.SliceHeader{
+		Data: uintptr(data),
+		Len:  count,
+		Cap:  count,
+	}))
+
+	res := get_res(slres)
+	array := make([]*table, count)
+
+	for i := 0; i < count; i++ {
+		array[i] = get_res(&carray[i])
+	}
+
+	snap := &snapshot{slres.last_update, res, array}
+
+	backend.Free(slres)
+
+	return snap
+}
+
+func load_node_snapshot(update_time C.time_t, show_flags C.uint16_t) (*snapshot, C.int) {
+	slres, errno := backend.LoadNode(update_time, show_flags)
+
+	if errno != 0 {
+		return nil, errno
+	}
+
+	return get_node_info(slres), 0
+}
+
 func load_node(w http.ResponseWriter, r *http.Request) {
 	opt := struct {
 		update_time C.time_t
@@ -380,36 +982,44 @@ func load_node(w http.ResponseWriter, r *http.Request) {
 	obj.Add(&opt)
 
 	obj.Run(w, r, func() {
-		var slres *C.node_info_msg_t
+		if_modified(r, &opt.update_time)
 
-		ret := C.slurm_load_node(opt.update_time, &slres, opt.show_flags)
+		snap, errno := cache_load("nodes", load_node_snapshot, opt.update_time, opt.show_flags)
 
-		if ret != 0 {
-			slurm_error(w, r)
+		if errno != 0 {
+			load_error(w, r, errno, opt.update_time)
 			return
 		}
 
-		data := unsafe.Pointer(slres.node_array)
-		count := int(slres.record_count)
-		carray := *(*[]C.node_info_t)(unsafe.Pointer(&reflect.SliceHeader{
-			Data: uintptr(data),
-			Len:  count,
-			Cap:  count,
-		}))
+		send_array(w, r, snap.res, "NodeArray", snap.array)
+	})
+}
 
-		res := get_res(slres)
-		array := make([]*table, count)
+func load_node_single(w http.ResponseWriter, r *http.Request) {
+	opt := struct {
+		node_name  *C.char
+		show_flags C.uint16_t
+	}{}
 
-		for i := 0; i < count; i++ {
-			array[i] = get_res(&carray[i])
+	obj := make(object_map)
+	obj.Add(&opt)
+
+	obj.Run(w, r, func() {
+		if opt.node_name == nil {
+			http_error(w, 400, "Missing key", "NodeName")
+			return
 		}
 
-		(*res)["NodeArray"] = array
+		slres, errno := backend.LoadNodeSingle(opt.node_name, opt.show_flags)
 
-		C.slurm_free_node_info_msg(slres)
+		if errno != 0 {
+			errno_error(w, r, errno)
+			return
+		}
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(&res)
+		snap := get_node_info(slres)
+
+		send_array(w, r, snap.res, "NodeArray", snap.array)
 	})
 }
 
@@ -421,10 +1031,10 @@ func update_node(w http.ResponseWriter, r *http.Request) {
 	obj.Add(&slreq)
 
 	obj.Run(w, r, func() {
-		ret := C.slurm_update_node(&slreq)
+		errno := backend.UpdateNode(&slreq)
 
-		if ret != 0 {
-			slurm_error(w, r)
+		if errno != 0 {
+			errno_error(w, r, errno)
 			return
 		}
 	})
@@ -440,10 +1050,14 @@ func signal_job(w http.ResponseWriter, r *http.Request) {
 	obj.Add(&opt)
 
 	obj.Run(w, r, func() {
-		ret := C.slurm_signal_job(opt.job_id, opt.signal)
+		if !job_owner(w, r, opt.job_id) {
+			return
+		}
 
-		if ret != 0 {
-			slurm_error(w, r)
+		errno := backend.SignalJob(opt.job_id, opt.signal)
+
+		if errno != 0 {
+			errno_error(w, r, errno)
 			return
 		}
 	})
@@ -460,10 +1074,14 @@ func signal_job_step(w http.ResponseWriter, r *http.Request) {
 	obj.Add(&opt)
 
 	obj.Run(w, r, func() {
-		ret := C.slurm_signal_job_step(opt.job_id, opt.step_id, opt.signal)
+		if !job_owner(w, r, opt.job_id) {
+			return
+		}
 
-		if ret != 0 {
-			slurm_error(w, r)
+		errno := backend.SignalJobStep(opt.job_id, opt.step_id, opt.signal)
+
+		if errno != 0 {
+			errno_error(w, r, errno)
 			return
 		}
 	})
@@ -480,10 +1098,14 @@ func kill_job(w http.ResponseWriter, r *http.Request) {
 	obj.Add(&opt)
 
 	obj.Run(w, r, func() {
-		ret := C.slurm_kill_job(opt.job_id, opt.signal, opt.batch_flag)
+		if !job_owner(w, r, opt.job_id) {
+			return
+		}
 
-		if ret != 0 {
-			slurm_error(w, r)
+		errno := backend.KillJob(opt.job_id, opt.signal, opt.batch_flag)
+
+		if errno != 0 {
+			errno_error(w, r, errno)
 			return
 		}
 	})
@@ -500,10 +1122,14 @@ func kill_job_step(w http.ResponseWriter, r *http.Request) {
 	obj.Add(&opt)
 
 	obj.Run(w, r, func() {
-		ret := C.slurm_kill_job_step(opt.job_id, opt.step_id, opt.signal)
+		if !job_owner(w, r, opt.job_id) {
+			return
+		}
+
+		errno := backend.KillJobStep(opt.job_id, opt.step_id, opt.signal)
 
-		if ret != 0 {
-			slurm_error(w, r)
+		if errno != 0 {
+			errno_error(w, r, errno)
 			return
 		}
 	})
@@ -519,10 +1145,14 @@ func complete_job(w http.ResponseWriter, r *http.Request) {
 	obj.Add(&opt)
 
 	obj.Run(w, r, func() {
-		ret := C.slurm_complete_job(opt.job_id, opt.job_return_code)
+		if !job_owner(w, r, opt.job_id) {
+			return
+		}
+
+		errno := backend.CompleteJob(opt.job_id, opt.job_return_code)
 
-		if ret != 0 {
-			slurm_error(w, r)
+		if errno != 0 {
+			errno_error(w, r, errno)
 			return
 		}
 	})
@@ -538,10 +1168,14 @@ func terminate_job_step(w http.ResponseWriter, r *http.Request) {
 	obj.Add(&opt)
 
 	obj.Run(w, r, func() {
-		ret := C.slurm_terminate_job_step(opt.job_id, opt.step_id)
+		if !job_owner(w, r, opt.job_id) {
+			return
+		}
+
+		errno := backend.TerminateJobStep(opt.job_id, opt.step_id)
 
-		if ret != 0 {
-			slurm_error(w, r)
+		if errno != 0 {
+			errno_error(w, r, errno)
 			return
 		}
 	})
@@ -556,10 +1190,10 @@ func suspend_job(w http.ResponseWriter, r *http.Request) {
 	obj.Add(&opt)
 
 	obj.Run(w, r, func() {
-		ret := C.slurm_suspend(opt.job_id)
+		errno := backend.Suspend(opt.job_id)
 
-		if ret != 0 {
-			slurm_error(w, r)
+		if errno != 0 {
+			errno_error(w, r, errno)
 			return
 		}
 	})
@@ -574,10 +1208,10 @@ func resume_job(w http.ResponseWriter, r *http.Request) {
 	obj.Add(&opt)
 
 	obj.Run(w, r, func() {
-		ret := C.slurm_resume(opt.job_id)
+		errno := backend.Resume(opt.job_id)
 
-		if ret != 0 {
-			slurm_error(w, r)
+		if errno != 0 {
+			errno_error(w, r, errno)
 			return
 		}
 	})
@@ -593,10 +1227,14 @@ func requeue_job(w http.ResponseWriter, r *http.Request) {
 	obj.Add(&opt)
 
 	obj.Run(w, r, func() {
-		ret := C.slurm_requeue(opt.job_id, opt.state)
+		if !job_owner(w, r, opt.job_id) {
+			return
+		}
+
+		errno := backend.Requeue(opt.job_id, opt.state)
 
-		if ret != 0 {
-			slurm_error(w, r)
+		if errno != 0 {
+			errno_error(w, r, errno)
 			return
 		}
 	})
@@ -612,12 +1250,12 @@ func load_licenses(w http.ResponseWriter, r *http.Request) {
 	obj.Add(&opt)
 
 	obj.Run(w, r, func() {
-		var slres *C.license_info_msg_t
+		if_modified(r, &opt.update_time)
 
-		ret := C.slurm_load_licenses(opt.update_time, &slres, opt.show_flags)
+		slres, errno := backend.LoadLicenses(opt.update_time, opt.show_flags)
 
-		if ret != 0 {
-			slurm_error(w, r)
+		if errno != 0 {
+			load_error(w, r, errno, opt.update_time)
 			return
 		}
 
@@ -636,15 +1274,41 @@ func load_licenses(w http.ResponseWriter, r *http.Request) {
 			array[i] = get_res(&carray[i])
 		}
 
-		(*res)["LicArray"] = array
+		backend.Free(slres)
 
-		C.slurm_free_license_info_msg(slres)
-
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(&res)
+		send_array(w, r, res, "LicArray", array)
 	})
 }
 
+func load_reservations_snapshot(update_time C.time_t, show_flags C.uint16_t) (*snapshot, C.int) {
+	slres, errno := backend.LoadReservations(update_time)
+
+	if errno != 0 {
+		return nil, errno
+	}
+
+	data := unsafe.Pointer(slres.reservation_array)
+	count := int(slres.record_count)
+	carray := *(*[]C.reserve_info_t)(unsafe.Pointer(&reflect.SliceHeader{
+		Data: uintptr(data),
+		Len:  count,
+		Cap:  count,
+	}))
+
+	res := get_res(slres)
+	array := make([]*table, count)
+
+	for i := 0; i < count; i++ {
+		array[i] = get_res(&carray[i])
+	}
+
+	snap := &snapshot{slres.last_update, res, array}
+
+	backend.Free(slres)
+
+	return snap, 0
+}
+
 func load_reservations(w http.ResponseWriter, r *http.Request) {
 	opt := struct {
 		update_time C.time_t
@@ -654,36 +1318,16 @@ func load_reservations(w http.ResponseWriter, r *http.Request) {
 	obj.Add(&opt)
 
 	obj.Run(w, r, func() {
-		var slres *C.reserve_info_msg_t
+		if_modified(r, &opt.update_time)
 
-		ret := C.slurm_load_reservations(opt.update_time, &slres)
+		snap, errno := cache_load("reservations", load_reservations_snapshot, opt.update_time, 0)
 
-		if ret != 0 {
-			slurm_error(w, r)
+		if errno != 0 {
+			load_error(w, r, errno, opt.update_time)
 			return
 		}
 
-		data := unsafe.Pointer(slres.reservation_array)
-		count := int(slres.record_count)
-		carray := *(*[]C.reserve_info_t)(unsafe.Pointer(&reflect.SliceHeader{
-			Data: uintptr(data),
-			Len:  count,
-			Cap:  count,
-		}))
-
-		res := get_res(slres)
-		array := make([]*table, count)
-
-		for i := 0; i < count; i++ {
-			array[i] = get_res(&carray[i])
-		}
-
-		(*res)["ReservationArray"] = array
-
-		C.slurm_free_reservation_info_msg(slres)
-
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(&res)
+		send_array(w, r, snap.res, "ReservationArray", snap.array)
 	})
 }
 
@@ -694,10 +1338,10 @@ func delete_reservation(w http.ResponseWriter, r *http.Request) {
 	obj.Add(&slreq)
 
 	obj.Run(w, r, func() {
-		ret := C.slurm_delete_reservation(&slreq)
+		errno := backend.DeleteReservation(&slreq)
 
-		if ret != 0 {
-			slurm_error(w, r)
+		if errno != 0 {
+			errno_error(w, r, errno)
 			return
 		}
 	})
@@ -711,17 +1355,18 @@ func create_reservation(w http.ResponseWriter, r *http.Request) {
 	obj.Add(&slreq)
 
 	obj.Run(w, r, func() {
-		ret := C.slurm_create_reservation(&slreq)
+		name, errno := backend.CreateReservation(&slreq)
 
-		if ret == nil {
-			slurm_error(w, r)
+		if errno != 0 {
+			errno_error(w, r, errno)
 			return
 		}
 
 		res := get_res(&slreq)
+		(*res)["Name"] = name
 
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(&res)
+		json.NewEncoder(w).Encode(get_output(r).Format("", res))
 	})
 }
 
@@ -733,46 +1378,45 @@ func update_reservation(w http.ResponseWriter, r *http.Request) {
 	obj.Add(&slreq)
 
 	obj.Run(w, r, func() {
-		ret := C.slurm_update_reservation(&slreq)
+		errno := backend.UpdateReservation(&slreq)
 
-		if ret != 0 {
-			slurm_error(w, r)
+		if errno != 0 {
+			errno_error(w, r, errno)
 			return
 		}
 	})
 }
 
 func get_triggers(w http.ResponseWriter, r *http.Request) {
-	var slres *C.trigger_info_msg_t
-
-	ret := C.slurm_get_triggers(&slres)
+	obj := make(object_map)
 
-	if ret != 0 {
-		slurm_error(w, r)
-		return
-	}
+	obj.Run(w, r, func() {
+		slres, errno := backend.GetTriggers()
 
-	data := unsafe.Pointer(slres.trigger_array)
-	count := int(slres.record_count)
-	carray := *(*[]C.trigger_info_t)(unsafe.Pointer(&reflect.SliceHeader{
-		Data: uintptr(data),
-		Len:  count,
-		Cap:  count,
-	}))
+		if errno != 0 {
+			errno_error(w, r, errno)
+			return
+		}
 
-	res := get_res(slres)
-	array := make([]*table, count)
+		data := unsafe.Pointer(slres.trigger_array)
+		count := int(slres.record_count)
+		carray := *(*[]C.trigger_info_t)(unsafe.Pointer(&reflect.SliceHeader{
+			Data: uintptr(data),
+			Len:  count,
+			Cap:  count,
+		}))
 
-	for i := 0; i < count; i++ {
-		array[i] = get_res(&carray[i])
-	}
+		res := get_res(slres)
+		array := make([]*table, count)
 
-	(*res)["TriggerArray"] = array
+		for i := 0; i < count; i++ {
+			array[i] = get_res(&carray[i])
+		}
 
-	C.slurm_free_trigger_msg(slres)
+		backend.Free(slres)
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(&res)
+		send_array(w, r, res, "TriggerArray", array)
+	})
 }
 
 func set_trigger(w http.ResponseWriter, r *http.Request) {
@@ -783,10 +1427,10 @@ func set_trigger(w http.ResponseWriter, r *http.Request) {
 	obj.Add(&slreq)
 
 	obj.Run(w, r, func() {
-		ret := C.slurm_set_trigger(&slreq)
+		errno := backend.SetTrigger(&slreq)
 
-		if ret != 0 {
-			slurm_error(w, r)
+		if errno != 0 {
+			errno_error(w, r, errno)
 			return
 		}
 	})
@@ -800,10 +1444,10 @@ func clear_trigger(w http.ResponseWriter, r *http.Request) {
 	obj.Add(&slreq)
 
 	obj.Run(w, r, func() {
-		ret := C.slurm_clear_trigger(&slreq)
+		errno := backend.ClearTrigger(&slreq)
 
-		if ret != 0 {
-			slurm_error(w, r)
+		if errno != 0 {
+			errno_error(w, r, errno)
 			return
 		}
 	})
@@ -818,10 +1462,10 @@ func takeover(w http.ResponseWriter, r *http.Request) {
 	obj.Add(&opt)
 
 	obj.Run(w, r, func() {
-		ret := C.slurm_takeover(opt.backup_inx)
+		errno := backend.Takeover(opt.backup_inx)
 
-		if ret != 0 {
-			slurm_error(w, r)
+		if errno != 0 {
+			errno_error(w, r, errno)
 			return
 		}
 	})
@@ -836,22 +1480,26 @@ func shutdown(w http.ResponseWriter, r *http.Request) {
 	obj.Add(&opt)
 
 	obj.Run(w, r, func() {
-		ret := C.slurm_shutdown(opt.options)
+		errno := backend.Shutdown(opt.options)
 
-		if ret != 0 {
-			slurm_error(w, r)
+		if errno != 0 {
+			errno_error(w, r, errno)
 			return
 		}
 	})
 }
 
 func reconfigure(w http.ResponseWriter, r *http.Request) {
-	ret := C.slurm_reconfigure()
+	obj := make(object_map)
 
-	if ret != 0 {
-		slurm_error(w, r)
-		return
-	}
+	obj.Run(w, r, func() {
+		errno := backend.Reconfigure()
+
+		if errno != 0 {
+			errno_error(w, r, errno)
+			return
+		}
+	})
 }
 
 func ping(w http.ResponseWriter, r *http.Request) {
@@ -863,15 +1511,44 @@ func ping(w http.ResponseWriter, r *http.Request) {
 	obj.Add(&opt)
 
 	obj.Run(w, r, func() {
-		ret := C.slurm_ping(opt.primary)
+		errno := backend.Ping(opt.primary)
 
-		if ret != 0 {
-			slurm_error(w, r)
+		if errno != 0 {
+			errno_error(w, r, errno)
 			return
 		}
 	})
 }
 
+func load_partitions_snapshot(update_time C.time_t, show_flags C.uint16_t) (*snapshot, C.int) {
+	slres, errno := backend.LoadPartitions(update_time, show_flags)
+
+	if errno != 0 {
+		return nil, errno
+	}
+
+	data := unsafe.Pointer(slres.partition_array)
+	count := int(slres.record_count)
+	carray := *(*[]C.partition_info_t)(unsafe.Pointer(&reflect.SliceHeader{
+		Data: uintptr(data),
+		Len:  count,
+		Cap:  count,
+	}))
+
+	res := get_res(slres)
+	array := make([]*table, count)
+
+	for i := 0; i < count; i++ {
+		array[i] = get_res(&carray[i])
+	}
+
+	snap := &snapshot{slres.last_update, res, array}
+
+	backend.Free(slres)
+
+	return snap, 0
+}
+
 func load_partitions(w http.ResponseWriter, r *http.Request) {
 	opt := struct {
 		update_time C.time_t
@@ -882,36 +1559,58 @@ func load_partitions(w http.ResponseWriter, r *http.Request) {
 	obj.Add(&opt)
 
 	obj.Run(w, r, func() {
-		var slres *C.partition_info_msg_t
+		if_modified(r, &opt.update_time)
 
-		ret := C.slurm_load_partitions(opt.update_time, &slres, opt.show_flags)
+		snap, errno := cache_load("partitions", load_partitions_snapshot, opt.update_time, opt.show_flags)
 
-		if ret != 0 {
-			slurm_error(w, r)
+		if errno != 0 {
+			load_error(w, r, errno, opt.update_time)
 			return
 		}
 
-		data := unsafe.Pointer(slres.partition_array)
-		count := int(slres.record_count)
-		carray := *(*[]C.partition_info_t)(unsafe.Pointer(&reflect.SliceHeader{
-			Data: uintptr(data),
-			Len:  count,
-			Cap:  count,
-		}))
+		send_array(w, r, snap.res, "PartitionArray", snap.array)
+	})
+}
 
-		res := get_res(slres)
-		array := make([]*table, count)
+func load_partition(w http.ResponseWriter, r *http.Request) {
+	opt := struct {
+		partition_name *C.char
+		update_time    C.time_t
+		show_flags     C.uint16_t
+	}{}
 
-		for i := 0; i < count; i++ {
-			array[i] = get_res(&carray[i])
+	obj := make(object_map)
+	obj.Add(&opt)
+
+	obj.Run(w, r, func() {
+		if_modified(r, &opt.update_time)
+
+		if opt.partition_name == nil {
+			http_error(w, 400, "Missing key", "PartitionName")
+			return
 		}
 
-		(*res)["PartitionArray"] = array
+		snap, errno := cache_load("partitions", load_partitions_snapshot, opt.update_time, opt.show_flags)
 
-		C.slurm_free_partition_info_msg(slres)
+		if errno != 0 {
+			load_error(w, r, errno, opt.update_time)
+			return
+		}
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(&res)
+		name := C.GoString(opt.partition_name)
+
+		for _, v := range snap.array {
+			if (*v)["Name"] == name {
+				res := table{
+					"LastUpdate":  (*snap.res)["LastUpdate"],
+					"RecordCount": uint(1),
+				}
+				send_array(w, r, &res, "PartitionArray", []*table{v})
+				return
+			}
+		}
+
+		http_error(w, 404, "Invalid partition name specified", "PartitionName")
 	})
 }
 
@@ -923,10 +1622,10 @@ func create_partition(w http.ResponseWriter, r *http.Request) {
 	obj.Add(&slreq)
 
 	obj.Run(w, r, func() {
-		ret := C.slurm_create_partition(&slreq)
+		errno := backend.CreatePartition(&slreq)
 
-		if ret != 0 {
-			slurm_error(w, r)
+		if errno != 0 {
+			errno_error(w, r, errno)
 			return
 		}
 	})
@@ -940,10 +1639,10 @@ func update_partition(w http.ResponseWriter, r *http.Request) {
 	obj.Add(&slreq)
 
 	obj.Run(w, r, func() {
-		ret := C.slurm_update_partition(&slreq)
+		errno := backend.UpdatePartition(&slreq)
 
-		if ret != 0 {
-			slurm_error(w, r)
+		if errno != 0 {
+			errno_error(w, r, errno)
 			return
 		}
 	})
@@ -956,28 +1655,57 @@ func delete_partition(w http.ResponseWriter, r *http.Request) {
 	obj.Add(&slreq)
 
 	obj.Run(w, r, func() {
-		ret := C.slurm_delete_partition(&slreq)
+		errno := backend.DeletePartition(&slreq)
 
-		if ret != 0 {
-			slurm_error(w, r)
+		if errno != 0 {
+			errno_error(w, r, errno)
 			return
 		}
 	})
 }
 
 func load_topo(w http.ResponseWriter, r *http.Request) {
-	var slres *C.topo_info_response_msg_t
+	obj := make(object_map)
 
-	ret := C.slurm_load_topo(&slres)
+	obj.Run(w, r, func() {
+		slres, errno := backend.LoadTopo()
 
-	if ret != 0 {
-		slurm_error(w, r)
-		return
+		if errno != 0 {
+			errno_error(w, r, errno)
+			return
+		}
+
+		data := unsafe.Pointer(slres.topo_array)
+		count := int(slres.record_count)
+		carray := *(*[]C.topo_info_t)(unsafe.Pointer(&reflect.SliceHeader{
+			Data: uintptr(data),
+			Len:  count,
+			Cap:  count,
+		}))
+
+		res := get_res(slres)
+		array := make([]*table, count)
+
+		for i := 0; i < count; i++ {
+			array[i] = get_res(&carray[i])
+		}
+
+		backend.Free(slres)
+
+		send_array(w, r, res, "TopoArray", array)
+	})
+}
+
+func load_frontend_snapshot(update_time C.time_t, show_flags C.uint16_t) (*snapshot, C.int) {
+	slres, errno := backend.LoadFrontEnd(update_time)
+
+	if errno != 0 {
+		return nil, errno
 	}
 
-	data := unsafe.Pointer(slres.topo_array)
+	data := unsafe.Pointer(slres.front_end_array)
 	count := int(slres.record_count)
-	carray := *(*[]C.topo_info_t)(unsafe.Pointer(&reflect.SliceHeader{
+	carray := *(*[]C.front_end_info_t)(unsafe.Pointer(&reflect.SliceHeader{
 		Data: uintptr(data),
 		Len:  count,
 		Cap:  count,
@@ -990,12 +1718,11 @@ func load_topo(w http.ResponseWriter, r *http.Request) {
 		array[i] = get_res(&carray[i])
 	}
 
-	(*res)["TopoArray"] = array
+	snap := &snapshot{slres.last_update, res, array}
 
-	C.slurm_free_topo_info_msg(slres)
+	backend.Free(slres)
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(&res)
+	return snap, 0
 }
 
 func load_frontend(w http.ResponseWriter, r *http.Request) {
@@ -1007,36 +1734,16 @@ func load_frontend(w http.ResponseWriter, r *http.Request) {
 	obj.Add(&opt)
 
 	obj.Run(w, r, func() {
-		var slres *C.front_end_info_msg_t
+		if_modified(r, &opt.update_time)
 
-		ret := C.slurm_load_front_end(opt.update_time, &slres)
+		snap, errno := cache_load("frontends", load_frontend_snapshot, opt.update_time, 0)
 
-		if ret != 0 {
-			slurm_error(w, r)
+		if errno != 0 {
+			load_error(w, r, errno, opt.update_time)
 			return
 		}
 
-		data := unsafe.Pointer(slres.front_end_array)
-		count := int(slres.record_count)
-		carray := *(*[]C.front_end_info_t)(unsafe.Pointer(&reflect.SliceHeader{
-			Data: uintptr(data),
-			Len:  count,
-			Cap:  count,
-		}))
-
-		res := get_res(slres)
-		array := make([]*table, count)
-
-		for i := 0; i < count; i++ {
-			array[i] = get_res(&carray[i])
-		}
-
-		(*res)["FrontEndArray"] = array
-
-		C.slurm_free_front_end_info_msg(slres)
-
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(&res)
+		send_array(w, r, snap.res, "FrontEndArray", snap.array)
 	})
 }
 
@@ -1048,10 +1755,10 @@ func update_frontend(w http.ResponseWriter, r *http.Request) {
 	obj.Add(&slreq)
 
 	obj.Run(w, r, func() {
-		ret := C.slurm_update_front_end(&slreq)
+		errno := backend.UpdateFrontEnd(&slreq)
 
-		if ret != 0 {
-			slurm_error(w, r)
+		if errno != 0 {
+			errno_error(w, r, errno)
 			return
 		}
 	})
@@ -1066,21 +1773,19 @@ func lookup_job(w http.ResponseWriter, r *http.Request) {
 	obj.Add(&opt)
 
 	obj.Run(w, r, func() {
-		var slres *C.resource_allocation_response_msg_t
+		slres, errno := backend.AllocationLookup(opt.job_id)
 
-		ret := C.slurm_allocation_lookup(opt.job_id, &slres)
-
-		if ret != 0 {
-			slurm_error(w, r)
+		if errno != 0 {
+			errno_error(w, r, errno)
 			return
 		}
 
 		res := get_res(slres)
 
-		C.slurm_free_resource_allocation_response_msg(slres)
+		backend.Free(slres)
 
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(&res)
+		json.NewEncoder(w).Encode(get_output(r).Format("", res))
 	})
 }
 
@@ -1092,21 +1797,179 @@ func alloc_job(w http.ResponseWriter, r *http.Request) {
 	obj.Add(&slreq)
 
 	obj.Run(w, r, func() {
-		var slres *C.resource_allocation_response_msg_t
+		if !job_identity(w, r, &slreq, false) {
+			return
+		}
+
+		slres, errno := backend.AllocateResources(&slreq)
+
+		if errno != 0 {
+			errno_error(w, r, errno)
+			return
+		}
+
+		res := get_res(slres)
+
+		backend.Free(slres)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(get_output(r).Format("", res))
+	})
+}
+
+func will_run_job(w http.ResponseWriter, r *http.Request) {
+	var slreq C.job_desc_msg_t
+	C.slurm_init_job_desc_msg(&slreq)
+
+	obj := make(object_map)
+	obj.Add(&slreq)
+
+	obj.Run(w, r, func() {
+		if !job_identity(w, r, &slreq, false) {
+			return
+		}
 
-		ret := C.slurm_allocate_resources(&slreq, &slres)
+		slres, errno := backend.JobWillRun(&slreq)
 
-		if ret != 0 {
-			slurm_error(w, r)
+		if errno != 0 {
+			errno_error(w, r, errno)
+			return
+		}
+
+		// no details, the job can run at all
+
+		if slres == nil {
 			return
 		}
 
 		res := get_res(slres)
 
-		C.slurm_free_resource_allocation_response_msg(slres)
+		backend.Free(slres)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(get_output(r).Format("", res))
+	})
+}
+
+func get_statistics(w http.ResponseWriter, r *http.Request) {
+	slreq := C.stats_info_request_msg_t{
+		command_id: C.STAT_COMMAND_GET,
+	}
+
+	obj := make(object_map)
+
+	obj.Run(w, r, func() {
+		slres, errno := backend.GetStatistics(&slreq)
+
+		if errno != 0 {
+			errno_error(w, r, errno)
+			return
+		}
+
+		// rpc arrays are not terminated, hide them from get_res
+
+		tmp := *slres
+		tmp.rpc_type_id = nil
+		tmp.rpc_type_cnt = nil
+		tmp.rpc_type_time = nil
+		tmp.rpc_user_id = nil
+		tmp.rpc_user_cnt = nil
+		tmp.rpc_user_time = nil
+
+		res := get_res(&tmp)
+
+		for _, key := range []string{"RpcTypeId", "RpcTypeCnt", "RpcTypeTime", "RpcUserId", "RpcUserCnt", "RpcUserTime"} {
+			delete(*res, key)
+		}
+
+		count := int(slres.rpc_type_size)
+		type_id := *(*[]C.uint16_t)(unsafe.Pointer(&reflect.SliceHeader{
+			Data: uintptr(unsafe.Pointer(slres.rpc_type_id)),
+			Len:  count,
+			Cap:  count,
+		}))
+		type_cnt := *(*[]C.uint32_t)(unsafe.Pointer(&reflect.SliceHeader{
+			Data: uintptr(unsafe.Pointer(slres.rpc_type_cnt)),
+			Len:  count,
+			Cap:  count,
+		}))
+		type_time := *(*[]C.uint64_t)(unsafe.Pointer(&reflect.SliceHeader{
+			Data: uintptr(unsafe.Pointer(slres.rpc_type_time)),
+			Len:  count,
+			Cap:  count,
+		}))
+
+		rpc_types := make(map[string]*table, count)
+
+		for i := 0; i < count; i++ {
+			rpc_types[strconv.Itoa(int(type_id[i]))] = rpc_stat(type_cnt[i], type_time[i])
+		}
+
+		count = int(slres.rpc_user_size)
+		user_id := *(*[]C.uint32_t)(unsafe.Pointer(&reflect.SliceHeader{
+			Data: uintptr(unsafe.Pointer(slres.rpc_user_id)),
+			Len:  count,
+			Cap:  count,
+		}))
+		user_cnt := *(*[]C.uint32_t)(unsafe.Pointer(&reflect.SliceHeader{
+			Data: uintptr(unsafe.Pointer(slres.rpc_user_cnt)),
+			Len:  count,
+			Cap:  count,
+		}))
+		user_time := *(*[]C.uint64_t)(unsafe.Pointer(&reflect.SliceHeader{
+			Data: uintptr(unsafe.Pointer(slres.rpc_user_time)),
+			Len:  count,
+			Cap:  count,
+		}))
+
+		rpc_users := make(map[string]*table, count)
+
+		for i := 0; i < count; i++ {
+			name := strconv.Itoa(int(user_id[i]))
+			if u, err := user.LookupId(name); err == nil {
+				name = u.Username
+			}
+			rpc_users[name] = rpc_stat(user_cnt[i], user_time[i])
+		}
+
+		(*res)["RpcTypeStats"] = rpc_types
+		(*res)["RpcUserStats"] = rpc_users
+
+		backend.Free(slres)
 
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(&res)
+		json.NewEncoder(w).Encode(get_output(r).Format("", res))
+	})
+}
+
+func rpc_stat(count C.uint32_t, time C.uint64_t) *table {
+	ret := table{
+		"Count":       uint(count),
+		"TotalTime":   uint(time),
+		"AverageTime": uint(0),
+	}
+
+	if count > 0 {
+		ret["AverageTime"] = uint(time) / uint(count)
+	}
+
+	return &ret
+}
+
+func reset_statistics(w http.ResponseWriter, r *http.Request) {
+	slreq := C.stats_info_request_msg_t{
+		command_id: C.STAT_COMMAND_RESET,
+	}
+
+	obj := make(object_map)
+
+	obj.Run(w, r, func() {
+		errno := backend.ResetStatistics(&slreq)
+
+		if errno != 0 {
+			errno_error(w, r, errno)
+			return
+		}
 	})
 }
 
@@ -1119,21 +1982,22 @@ func load_ctl_conf(w http.ResponseWriter, r *http.Request) {
 	obj.Add(&opt)
 
 	obj.Run(w, r, func() {
-		var slres *C.slurm_conf_t
+		if_modified(r, &opt.update_time)
 
-		ret := C.slurm_load_ctl_conf(opt.update_time, &slres)
+		slres, errno := backend.LoadCtlConf(opt.update_time)
 
-		if ret != 0 {
-			slurm_error(w, r)
+		if errno != 0 {
+			load_error(w, r, errno, opt.update_time)
 			return
 		}
 
 		res := get_res(slres)
 
-		C.slurm_free_ctl_conf(slres)
+		backend.Free(slres)
 
+		set_last_modified(w, r, res)
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(&res)
+		json.NewEncoder(w).Encode(get_output(r).Format("", res))
 	})
 }
 
@@ -1169,58 +2033,39 @@ func tasks_checkpoint(w http.ResponseWriter, r *http.Request) {
 }
 */
 
-func main() {
-	var (
-		addr = flag.String("addr", ":8443", "adresse to serve")
-		cert = flag.String("cert", "server.crt", "certificate")
-		key  = flag.String("key", "server.key", "certificate key")
-		ca   = flag.String("ca", "ca.crt", "ca certificate")
-	)
-
-	flag.Parse()
-
-	ca_cert, err := ioutil.ReadFile(*ca)
-
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	ca_pool := x509.NewCertPool()
-	ca_pool.AppendCertsFromPEM(ca_cert)
-
-	server := &http.Server{
-		Addr: *addr,
-		TLSConfig: &tls.Config{
-			ClientAuth: tls.RequireAndVerifyClientCert,
-			ClientCAs:  ca_pool,
-		},
-	}
+// routes registers the endpoints
 
+func routes() {
 	// this api is only for test... no comment :)
 
-	http.HandleFunc("/nodes", load_node)
-	http.HandleFunc("/node/update", update_node)
-
-	http.HandleFunc("/licenses", load_licenses)
-
-	http.HandleFunc("/conf", load_ctl_conf)
-
-	http.HandleFunc("/jobs", load_jobs)
-	http.HandleFunc("/job/alloc", alloc_job)
-	http.HandleFunc("/job/submit", submit_batch_job)
-	http.HandleFunc("/job/lookup", lookup_job)
-	http.HandleFunc("/job/update", update_job)
-	http.HandleFunc("/job/notify", notify_job)
-	http.HandleFunc("/job/kill", kill_job)
-	http.HandleFunc("/job/signal", signal_job)
-	http.HandleFunc("/job/complete", complete_job)
-	http.HandleFunc("/job/suspend", suspend_job)
-	http.HandleFunc("/job/resume", resume_job)
-	http.HandleFunc("/job/requeue", requeue_job)
-
-	http.HandleFunc("/job/step/kill", kill_job_step)
-	http.HandleFunc("/job/step/signal", signal_job_step)
-	http.HandleFunc("/job/step/terminate", terminate_job_step)
+	handle("/nodes", role_readonly, list(node_params, load_node), records("NodeArray", C.node_info_msg_t{}, C.node_info_t{}))
+	handle("/node/info", role_readonly, load_node_single, records("NodeArray", C.node_info_msg_t{}, C.node_info_t{}))
+	handle("/node/update", role_operator, update_node, api_doc{})
+
+	handle("/licenses", role_readonly, load_licenses, records("LicArray", C.license_info_msg_t{}, C.slurm_license_info_t{}))
+
+	handle("/conf", role_readonly, load_ctl_conf, record(C.slurm_conf_t{}))
+
+	handle("/jobs", role_readonly, list(job_params, load_jobs), records("JobArray", C.job_info_msg_t{}, C.job_info_t{}))
+	handle("/events/jobs", role_readonly, job_events, raw("text/event-stream"))
+	handle("/job/alloc", role_user, alloc_job, record(C.resource_allocation_response_msg_t{}))
+	handle("/job/submit", role_user, submit_batch_job, record(C.submit_response_msg_t{}))
+	handle("/job/info", role_readonly, load_job, records("JobArray", C.job_info_msg_t{}, C.job_info_t{}))
+	handle("/job/willrun", role_user, will_run_job, record(C.will_run_response_msg_t{}))
+	handle("/job/lookup", role_readonly, lookup_job, record(C.resource_allocation_response_msg_t{}))
+	handle("/job/update", role_user, update_job, api_doc{})
+	handle("/job/notify", role_operator, notify_job, api_doc{})
+	handle("/job/kill", role_user, kill_job, api_doc{})
+	handle("/job/signal", role_user, signal_job, api_doc{})
+	handle("/job/complete", role_user, complete_job, api_doc{})
+	handle("/job/suspend", role_operator, suspend_job, api_doc{})
+	handle("/job/resume", role_operator, resume_job, api_doc{})
+	handle("/job/requeue", role_user, requeue_job, api_doc{})
+
+	handle("/job/steps", role_readonly, get_job_steps, records("JobSteps", C.job_step_info_response_msg_t{}, C.job_step_info_t{}))
+	handle("/job/step/kill", role_user, kill_job_step, api_doc{})
+	handle("/job/step/signal", role_user, signal_job_step, api_doc{})
+	handle("/job/step/terminate", role_user, terminate_job_step, api_doc{})
 
 	/* TODO
 	http.HandleFunc("/checkpoint/able", able_checkpoint)
@@ -1236,36 +2081,135 @@ func main() {
 	http.HandleFunc("/checkpoint/tasks", tasks_checkpoint)
 	*/
 
-	http.HandleFunc("/frontends", load_frontend)
-	http.HandleFunc("/frontend/update", update_frontend)
+	handle("/frontends", role_readonly, load_frontend, records("FrontEndArray", C.front_end_info_msg_t{}, C.front_end_info_t{}))
+	handle("/frontend/update", role_operator, update_frontend, api_doc{})
+
+	handle("/topologies", role_readonly, load_topo, records("TopoArray", C.topo_info_response_msg_t{}, C.topo_info_t{}))
+
+	handle("/partitions", role_readonly, load_partitions, records("PartitionArray", C.partition_info_msg_t{}, C.partition_info_t{}))
+	handle("/partition/info", role_readonly, load_partition, records("PartitionArray", C.partition_info_msg_t{}, C.partition_info_t{}))
+	handle("/partition/create", role_admin, create_partition, api_doc{})
+	handle("/partition/update", role_admin, update_partition, api_doc{})
+	handle("/partition/delete", role_admin, delete_partition, api_doc{})
+
+	handle("/reservations", role_readonly, load_reservations, records("ReservationArray", C.reserve_info_msg_t{}, C.reserve_info_t{}))
+	handle("/reservation/create", role_operator, create_reservation, reservation_doc)
+	handle("/reservation/update", role_operator, update_reservation, api_doc{})
+	handle("/reservation/delete", role_operator, delete_reservation, api_doc{})
+
+	handle("/triggers", role_readonly, get_triggers, records("TriggerArray", C.trigger_info_msg_t{}, C.trigger_info_t{}))
+	handle("/trigger/create", role_operator, set_trigger, api_doc{})
+	handle("/trigger/delete", role_operator, clear_trigger, api_doc{})
+
+	handle_rest("/jobs/", rest_route{
+		"GET":    {role_readonly, load_job, "JobId", nil, records("JobArray", C.job_info_msg_t{}, C.job_info_t{})},
+		"PATCH":  {role_user, update_job, "JobId", nil, api_doc{}},
+		"DELETE": {role_user, kill_job, "JobId", map[string]string{"Signal": strconv.Itoa(C.SIGKILL)}, api_doc{}},
+	})
+
+	handle_rest("/nodes/", rest_route{
+		"GET":   {role_readonly, match("Name", load_node_single), "NodeName", nil, record(C.node_info_t{})},
+		"PATCH": {role_operator, update_node, "NodeNames", nil, api_doc{}},
+	})
+
+	handle_rest("/frontends/", rest_route{
+		"GET":   {role_readonly, match("Name", load_frontend), "", nil, record(C.front_end_info_t{})},
+		"PATCH": {role_operator, update_frontend, "Name", nil, api_doc{}},
+	})
+
+	handle_rest("/partitions/", rest_route{
+		"GET":    {role_readonly, match("Name", load_partition), "PartitionName", nil, record(C.partition_info_t{})},
+		"PUT":    {role_admin, create_partition, "Name", nil, api_doc{}},
+		"PATCH":  {role_admin, update_partition, "Name", nil, api_doc{}},
+		"DELETE": {role_admin, delete_partition, "Name", nil, api_doc{}},
+	})
+
+	handle_rest("/reservations/", rest_route{
+		"GET":    {role_readonly, match("Name", load_reservations), "", nil, record(C.reserve_info_t{})},
+		"PUT":    {role_operator, create_reservation, "Name", nil, reservation_doc},
+		"PATCH":  {role_operator, update_reservation, "Name", nil, api_doc{}},
+		"DELETE": {role_operator, delete_reservation, "Name", nil, api_doc{}},
+	})
+
+	handle_rest("/licenses/", rest_route{
+		"GET": {role_readonly, match("Name", load_licenses), "", nil, record(C.slurm_license_info_t{})},
+	})
+
+	handle_rest("/triggers/", rest_route{
+		"GET":    {role_readonly, match("TrigId", get_triggers), "", nil, record(C.trigger_info_t{})},
+		"DELETE": {role_operator, clear_trigger, "TrigId", nil, api_doc{}},
+	})
+
+	handle("/metrics", role_readonly, get_metrics, raw("text/plain; version=0.0.4"))
+
+	handle("/ping", role_readonly, ping, api_doc{})
+	handle("/diag", role_readonly, get_statistics, statistics_doc)
+	handle("/diag/reset", role_admin, reset_statistics, api_doc{})
+	handle("/reconfigure", role_admin, reconfigure, api_doc{})
+	handle("/shutdown", role_admin, shutdown, api_doc{})
+	handle("/takeover", role_admin, takeover, api_doc{})
 
-	http.HandleFunc("/topologies", load_topo)
+	handle("/openapi.json", role_none, get_openapi, raw("application/json"))
+}
+
+func main() {
+	var (
+		conf = flag.String("config", "", "configuration file, reloaded on SIGHUP")
+		hkey = flag.String("webhook-key", "", "key to sign the webhooks, enables the CallbackUrl of /job/submit")
+		hdb  = flag.String("webhook-state", "webhooks.json", "file to save the pending webhooks")
+		hnet = flag.String("webhook-allow", "", "private networks the webhooks may call, separated by commas")
+		fake = flag.Int("fake", 0, "serve an in-memory cluster of this many nodes instead of slurm, for testing")
+	)
 
-	http.HandleFunc("/partitions", load_partitions)
-	http.HandleFunc("/partition/create", create_partition)
-	http.HandleFunc("/partition/update", update_partition)
-	http.HandleFunc("/partition/delete", delete_partition)
+	config_flags()
 
-	http.HandleFunc("/reservations", load_reservations)
-	http.HandleFunc("/reservation/create", create_reservation)
-	http.HandleFunc("/reservation/update", update_reservation)
-	http.HandleFunc("/reservation/delete", delete_reservation)
+	flag.Parse()
 
-	http.HandleFunc("/triggers", get_triggers)
-	http.HandleFunc("/trigger/create", set_trigger)
-	http.HandleFunc("/trigger/delete", clear_trigger)
+	if *fake > 0 {
+		backend = new_fake_cluster(*fake)
+	}
 
-	http.HandleFunc("/ping", ping)
-	http.HandleFunc("/reconfigure", reconfigure)
-	http.HandleFunc("/shutdown", shutdown)
-	http.HandleFunc("/takeover", takeover)
+	routes()
 
-	log.Println("Listening...")
+	if err := openapi_init(); err != nil {
+		log.Fatal(err)
+	}
 
-	// disable goroutine ?
-	err = server.ListenAndServeTLS(*cert, *key)
+	c, err := load_config(*conf)
 
 	if err != nil {
 		log.Fatal(err)
 	}
+
+	if err := webhook_init(*hkey, *hdb, *hnet); err != nil {
+		log.Fatal(err)
+	}
+
+	handler := gate(http.DefaultServeMux, output(instrument(http.DefaultServeMux)))
+
+	if err := apply_config(c, handler); err != nil {
+		log.Fatal(err)
+	}
+
+	// a new config is only applied once it is entirely loaded,
+	// the requests in progress end with the one they started with
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	for range hup {
+		c, err := load_config(*conf)
+
+		if err == nil {
+			err = apply_config(c, handler)
+		}
+
+		if err != nil {
+			log.Println("reload:", err)
+			continue
+		}
+
+		log.Println("Reloaded", *conf)
+	}
+
 }
@@ -0,0 +1,487 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// the suite runs every route against a fake cluster of 4 nodes,
+// as the clients below: alice and bob are users, uid 1000 and 1001
+
+var handler http.Handler
+
+func TestMain(m *testing.M) {
+	log.SetOutput(ioutil.Discard)
+
+	backend = new_fake_cluster(4)
+
+	routes()
+
+	if err := openapi_init(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	live.Store(&config{
+		ident: &identity_config{
+			source: "cn",
+			users: map[string]identity{
+				"alice":  {"alice", 1000, 1000},
+				"bob":    {"bob", 1001, 1001},
+				"reader": {"reader", 1002, 1002},
+				"oper":   {"oper", 1003, 1003},
+				"admin":  {"admin", 0, 0},
+			},
+		},
+		policy: &policy_config{
+			roles: map[string]role{
+				"reader": role_readonly,
+				"oper":   role_operator,
+				"admin":  role_admin,
+			},
+			fallback: role_user,
+		},
+		max_body:        1 << 20,
+		metrics_ttl:     time.Second,
+		events_interval: 10 * time.Millisecond,
+	})
+
+	handler = gate(http.DefaultServeMux, output(instrument(http.DefaultServeMux)))
+
+	os.Exit(m.Run())
+}
+
+func serve(ctx context.Context, user, method, path, body string, header ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body)).WithContext(ctx)
+
+	if user != "" {
+		r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{
+			{Subject: pkix.Name{CommonName: user}},
+		}}
+	}
+
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Set(header[i], header[i+1])
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	return w
+}
+
+type route_test struct {
+	user   string
+	method string
+	path   string
+	body   string
+	status int
+}
+
+// the tests run in order on the same cluster: alice has the job 1
+// and bob the job 2, both running on a node of the partition debug
+
+var route_tests = []route_test{
+	{"", "GET", "/openapi.json", "", 200},
+	{"reader", "GET", "/ping", "", 200},
+	{"reader", "GET", "/conf", "", 200},
+	{"reader", "GET", "/diag", "", 200},
+	{"reader", "GET", "/metrics", "", 200},
+	{"reader", "GET", "/licenses", "", 200},
+	{"reader", "GET", "/licenses/none", "", 404},
+	{"reader", "GET", "/topologies", "", 200},
+	{"reader", "GET", "/frontends", "", 200},
+	{"reader", "GET", "/frontends/none", "", 404},
+	{"oper", "POST", "/frontend/update", `{"Name":"none"}`, 404},
+	{"oper", "PATCH", "/frontends/none", `{}`, 404},
+
+	{"", "GET", "/nodes", "", 403},
+	{"reader", "GET", "/nodes", "", 200},
+	{"reader", "GET", "/node/info", `{"NodeName":"node1"}`, 200},
+	{"reader", "GET", "/nodes/node1", "", 200},
+	{"reader", "GET", "/nodes/none", "", 404},
+	{"alice", "POST", "/node/update", `{"NodeNames":"node4","NodeState":"DRAIN","Reason":"test"}`, 403},
+	{"oper", "POST", "/node/update", `{"NodeNames":"node4","NodeState":"DRAIN","Reason":"test"}`, 200},
+	{"oper", "PATCH", "/nodes/node4", `{"NodeState":"RESUME"}`, 200},
+
+	{"reader", "POST", "/job/submit", `{"Script":"#!/bin/sh\ntrue"}`, 403},
+	{"alice", "POST", "/job/submit", `{"Script":"#!/bin/sh\ntrue","Name":"a"}`, 200},
+	{"bob", "POST", "/job/submit", `{"Script":"#!/bin/sh\ntrue","Name":"b"}`, 200},
+	{"alice", "POST", "/job/submit", `{"Name":"no script"}`, 400},
+	{"alice", "POST", "/job/submit", `{"Script":"#!/bin/sh\ntrue","EnvSize":100}`, 400},
+	{"alice", "POST", "/job/willrun", `{"MinNodes":1}`, 200},
+	{"alice", "POST", "/job/alloc", `{"MinNodes":1,"Name":"c"}`, 200},
+	{"reader", "GET", "/jobs", "", 200},
+	{"reader", "GET", "/job/info", `{"JobId":1}`, 200},
+	{"reader", "GET", "/job/info", `{"JobId":99}`, 404},
+	{"reader", "GET", "/jobs/1", "", 200},
+	{"reader", "GET", "/job/lookup", `{"JobId":1}`, 200},
+	{"reader", "GET", "/job/steps", "", 200},
+	{"reader", "GET", "/events/jobs", "", 200},
+
+	{"bob", "POST", "/job/update", `{"JobId":1,"Comment":"bob"}`, 403},
+	{"bob", "POST", "/job/update", `{"Comment":"bob"}`, 403},
+	{"alice", "POST", "/job/update", `{"JobId":1,"Comment":"alice"}`, 200},
+	{"bob", "POST", "/job/update", `{"JobId":2,"JobIdStr":"1","Comment":"bob"}`, 403},
+	{"bob", "PATCH", "/jobs/2", `{"JobIdStr":"1","Comment":"bob"}`, 403},
+	{"oper", "POST", "/job/update", `{"JobIdStr":"1","Comment":"oper"}`, 200},
+	{"bob", "PATCH", "/jobs/1", `{"Comment":"bob"}`, 403},
+	{"alice", "PATCH", "/jobs/1", `{"Comment":"alice"}`, 200},
+	{"alice", "POST", "/job/notify", `{"JobId":1,"Message":"hi"}`, 403},
+	{"oper", "POST", "/job/notify", `{"JobId":1,"Message":"hi"}`, 200},
+	{"bob", "POST", "/job/signal", `{"JobId":1,"Signal":10}`, 403},
+	{"alice", "POST", "/job/signal", `{"JobId":1,"Signal":10}`, 200},
+	{"bob", "POST", "/job/step/signal", `{"JobId":1,"StepId":0,"Signal":10}`, 403},
+	{"alice", "POST", "/job/step/signal", `{"JobId":1,"StepId":0,"Signal":10}`, 200},
+	{"alice", "POST", "/job/suspend", `{"JobId":1}`, 403},
+	{"oper", "POST", "/job/suspend", `{"JobId":1}`, 200},
+	{"oper", "POST", "/job/resume", `{"JobId":1}`, 200},
+	{"bob", "POST", "/job/step/kill", `{"JobId":1,"StepId":0,"Signal":9}`, 403},
+	{"alice", "POST", "/job/step/kill", `{"JobId":1,"StepId":0,"Signal":10}`, 200},
+	{"bob", "POST", "/job/step/terminate", `{"JobId":1,"StepId":0}`, 403},
+	{"alice", "POST", "/job/step/terminate", `{"JobId":1,"StepId":0}`, 200},
+	{"bob", "POST", "/job/requeue", `{"JobId":1}`, 403},
+	{"alice", "POST", "/job/requeue", `{"JobId":1}`, 200},
+	{"bob", "POST", "/job/complete", `{"JobId":3,"JobReturnCode":0}`, 403},
+	{"alice", "POST", "/job/complete", `{"JobId":3,"JobReturnCode":0}`, 200},
+	{"bob", "POST", "/job/kill", `{"JobId":1,"Signal":9}`, 403},
+	{"alice", "POST", "/job/kill", `{"JobId":1,"Signal":9}`, 200},
+	{"alice", "DELETE", "/jobs/2", "", 403},
+	{"bob", "DELETE", "/jobs/2", "", 200},
+	{"oper", "DELETE", "/jobs/99", "", 404},
+
+	{"reader", "GET", "/partitions", "", 200},
+	{"reader", "GET", "/partition/info", `{"PartitionName":"debug"}`, 200},
+	{"reader", "GET", "/partitions/debug", "", 200},
+	{"oper", "POST", "/partition/create", `{"Name":"test","Nodes":"node1,node2"}`, 403},
+	{"admin", "POST", "/partition/create", `{"Name":"test","Nodes":"node1,node2"}`, 200},
+	{"admin", "POST", "/partition/update", `{"Name":"test","MaxTime":60}`, 200},
+	{"admin", "POST", "/partition/delete", `{"Name":"test"}`, 200},
+	{"admin", "PUT", "/partitions/test", `{"Nodes":"node3"}`, 200},
+	{"admin", "PATCH", "/partitions/test", `{"MaxTime":"infinite"}`, 200},
+	{"admin", "DELETE", "/partitions/test", "", 200},
+	{"admin", "DELETE", "/partitions/test", "", 404},
+
+	{"reader", "GET", "/reservations", "", 200},
+	{"alice", "POST", "/reservation/create", `{"Name":"r1","NodeCnt":[1]}`, 403},
+	{"oper", "POST", "/reservation/create", `{"Name":"r1","NodeCnt":[1,0],"Users":"alice"}`, 400},
+	{"oper", "POST", "/reservation/create", `{"Name":"r1","NodeCnt":[1],"Users":"alice"}`, 200},
+	{"oper", "POST", "/reservation/update", `{"Name":"r1","Users":"bob"}`, 200},
+	{"reader", "GET", "/reservations/r1", "", 200},
+	{"oper", "POST", "/reservation/delete", `{"Name":"r1"}`, 200},
+	{"oper", "PUT", "/reservations/r2", `{"NodeList":"node2"}`, 200},
+	{"oper", "PATCH", "/reservations/r2", `{"Accounts":"test"}`, 200},
+	{"oper", "DELETE", "/reservations/r2", "", 200},
+	{"oper", "DELETE", "/reservations/r2", "", 404},
+
+	{"oper", "POST", "/trigger/create", `{"ResType":1,"ResId":"node1","TrigType":2,"Program":"/bin/true"}`, 200},
+	{"reader", "GET", "/triggers", "", 200},
+	{"reader", "GET", "/triggers/1", "", 200},
+	{"oper", "POST", "/trigger/delete", `{"TrigId":1}`, 200},
+	{"oper", "POST", "/trigger/create", `{"ResType":1,"ResId":"node2","TrigType":2,"Program":"/bin/true"}`, 200},
+	{"oper", "DELETE", "/triggers/2", "", 200},
+	{"oper", "DELETE", "/triggers/2", "", 404},
+
+	{"oper", "POST", "/diag/reset", "", 403},
+	{"admin", "POST", "/diag/reset", "", 200},
+	{"admin", "POST", "/reconfigure", "", 200},
+	{"oper", "POST", "/shutdown", "", 403},
+	{"admin", "POST", "/shutdown", `{"Options":70000}`, 400},
+	{"admin", "POST", "/shutdown", `{"Options":2}`, 200},
+	{"oper", "POST", "/takeover", "", 403},
+	{"admin", "POST", "/takeover", `{"BackupInx":1}`, 200},
+}
+
+func TestRoutes(t *testing.T) {
+	for _, test := range route_tests {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		w := serve(ctx, test.user, test.method, test.path, test.body)
+		cancel()
+
+		if w.Code != test.status {
+			t.Errorf("%s %s %s as %q: status %d, expected %d: %s",
+				test.method, test.path, test.body, test.user, w.Code, test.status, w.Body)
+		}
+	}
+}
+
+// TestRoutesTested checks that every route and method has a test
+
+func TestRoutesTested(t *testing.T) {
+	tested := make(map[string]bool)
+
+	for _, test := range route_tests {
+		path := test.path
+		if i := strings.Index(path[1:], "/"); i >= 0 && has_route(path[:i+2]) {
+			path = path[:i+2]
+		}
+		tested[test.method+" "+path] = true
+	}
+
+	for _, route := range api_routes {
+		if route.rest == nil {
+			method := "POST"
+			if route.role <= role_readonly {
+				method = "GET"
+			}
+			if !tested[method+" "+route.path] {
+				t.Errorf("no test for %s %s", method, route.path)
+			}
+			continue
+		}
+		for method := range route.rest {
+			if !tested[method+" "+route.path] {
+				t.Errorf("no test for %s %s", method, route.path)
+			}
+		}
+	}
+}
+
+func TestConditional(t *testing.T) {
+	ctx := context.Background()
+	w := serve(ctx, "reader", "GET", "/nodes", "")
+
+	etag := w.Header().Get("ETag")
+
+	if w.Code != 200 || etag == "" {
+		t.Fatalf("status %d, ETag %q", w.Code, etag)
+	}
+
+	w = serve(ctx, "reader", "GET", "/nodes", "", "If-None-Match", etag)
+
+	if w.Code != 304 || w.Header().Get("ETag") != etag || w.Body.Len() != 0 {
+		t.Errorf("If-None-Match: status %d, ETag %q, body %q", w.Code, w.Header().Get("ETag"), w.Body)
+	}
+
+	w = serve(ctx, "reader", "GET", "/nodes?fields=Name", "", "If-None-Match", etag)
+
+	if w.Code != 200 || w.Header().Get("ETag") == etag {
+		t.Errorf("If-None-Match of another query: status %d, ETag %q", w.Code, w.Header().Get("ETag"))
+	}
+
+	other := w.Header().Get("ETag")
+	w = serve(ctx, "reader", "GET", "/nodes?fields=Name", "", "If-None-Match", other)
+
+	if w.Code != 304 || w.Header().Get("ETag") != other {
+		t.Errorf("If-None-Match with fields: status %d, ETag %q", w.Code, w.Header().Get("ETag"))
+	}
+
+	var res struct {
+		LastUpdate int64
+	}
+
+	json.NewDecoder(serve(ctx, "reader", "GET", "/nodes?times=unix", "").Body).Decode(&res)
+
+	w = serve(ctx, "reader", "GET", "/nodes", fmt.Sprintf(`{"UpdateTime":%d}`, res.LastUpdate+1))
+
+	if w.Code != 304 || w.Header().Get("ETag") != etag || w.Body.Len() != 0 {
+		t.Errorf("UpdateTime: status %d, ETag %q, body %q", w.Code, w.Header().Get("ETag"), w.Body)
+	}
+}
+
+// the fake only records shutdown and takeover, the options must get there
+
+func TestShutdown(t *testing.T) {
+	saved := backend
+	defer func() { backend = saved }()
+
+	f := new_fake_cluster(1)
+	backend = f
+	ctx := context.Background()
+
+	serve(ctx, "oper", "POST", "/shutdown", `{"Options":1}`)
+	serve(ctx, "admin", "POST", "/shutdown", `{"Options":2}`)
+	serve(ctx, "admin", "POST", "/takeover", `{"BackupInx":1}`)
+
+	if len(f.shutdowns) != 1 || f.shutdowns[0] != 2 {
+		t.Errorf("shutdowns %v, expected [2]", f.shutdowns)
+	}
+
+	if len(f.takeovers) != 1 || f.takeovers[0] != 1 {
+		t.Errorf("takeovers %v, expected [1]", f.takeovers)
+	}
+}
+
+func TestBuckets(t *testing.T) {
+	if take_token("idle", 1, 2) != 0 || take_token("idle", 1, 2) != 0 || take_token("idle", 1, 2) == 0 {
+		t.Fatalf("a burst of 2 allowed a third request")
+	}
+
+	take_token("busy", 1, 2)
+	take_token("busy", 1, 2)
+
+	// idle has been refilled, busy not yet
+
+	buckets.Lock()
+	buckets.clients["idle"].time = time.Now().Add(-time.Hour)
+	buckets.sweep = time.Time{}
+	buckets.Unlock()
+
+	take_token("other", 1, 2)
+
+	buckets.Lock()
+	_, idle := buckets.clients["idle"]
+	_, busy := buckets.clients["busy"]
+	buckets.Unlock()
+
+	if idle || !busy {
+		t.Errorf("idle kept %v, busy kept %v", idle, busy)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	w := serve(context.Background(), "reader", "GET", "/metrics", "")
+
+	if !strings.Contains(w.Body.String(), "\nslurmctld_jobs_submitted_total ") {
+		t.Errorf("no slurmctld_jobs_submitted_total in %q", w.Body)
+	}
+
+	for _, line := range strings.Split(w.Body.String(), "\n") {
+		f := strings.Fields(line)
+		if len(f) == 4 && f[1] == "TYPE" && f[3] == "counter" && !strings.HasSuffix(f[2], "_total") {
+			t.Errorf("counter %s doesn't end with _total", f[2])
+		}
+	}
+}
+
+func TestList(t *testing.T) {
+	saved := backend
+	defer func() { backend = saved }()
+
+	backend = new_fake_cluster(4)
+	ctx := context.Background()
+
+	serve(ctx, "oper", "POST", "/node/update", `{"NodeNames":"node3","NodeState":"DOWN","Reason":"test"}`)
+
+	for _, test := range []struct {
+		query string
+		names []string
+	}{
+		{"name=node1&name=node3", []string{"node1", "node3"}},
+		{"name=node1,node2&name=node4", []string{"node1", "node2", "node4"}},
+		{"name=node1&name=node3&fields=Name&fields=NodeState", []string{"node1", "node3"}},
+		{"sort=NodeStateName,-Name", []string{"node3", "node4", "node2", "node1"}},
+		{"sort=NodeStateName,-Name&limit=2&cursor=1", []string{"node4", "node2"}},
+	} {
+		var res struct {
+			NodeArray []map[string]interface{}
+		}
+
+		w := serve(ctx, "reader", "GET", "/nodes?"+test.query, "")
+		json.NewDecoder(w.Body).Decode(&res)
+
+		var names []string
+
+		for _, node := range res.NodeArray {
+			names = append(names, fmt.Sprint(node["Name"]))
+		}
+
+		if strings.Join(names, ",") != strings.Join(test.names, ",") {
+			t.Errorf("%s: %v, expected %v", test.query, names, test.names)
+		}
+	}
+
+	var res struct {
+		NodeArray []map[string]interface{}
+	}
+
+	w := serve(ctx, "reader", "GET", "/nodes?name=node3&fields=Name,NodeStateName", "")
+	json.NewDecoder(w.Body).Decode(&res)
+
+	if len(res.NodeArray) != 1 || len(res.NodeArray[0]) != 2 || res.NodeArray[0]["NodeStateName"] != "DOWN" {
+		t.Errorf("fields=Name,NodeStateName: %v", res.NodeArray)
+	}
+}
+
+func TestFormatTimes(t *testing.T) {
+	start := time.Unix(86400, 0).Format(time.RFC3339)
+	sub := table{"StartTime": time_value(86400)}
+	rec := table{"Sub": &sub, "Array": []interface{}{&sub, 1}, "EndTime": time_value(0)}
+
+	ret := (&output_options{times: true}).Format("", &rec)
+
+	if v := (*(*ret)["Sub"].(*table))["StartTime"]; v != start {
+		t.Errorf("Sub.StartTime is %v, expected %s", v, start)
+	}
+
+	if v := (*(*ret)["Array"].([]interface{})[0].(*table))["StartTime"]; v != start {
+		t.Errorf("Array[0].StartTime is %v, expected %s", v, start)
+	}
+
+	if v := (*ret)["EndTime"]; v != nil {
+		t.Errorf("EndTime is %v, expected nil", v)
+	}
+
+	if _, ok := sub["StartTime"].(time_value); !ok {
+		t.Errorf("the shared record was modified")
+	}
+}
+
+// a job removed from the fake is gone from the next snapshot,
+// as when slurmctld purges it
+
+func TestPurged(t *testing.T) {
+	saved := backend
+	defer func() { backend = saved }()
+
+	for deadline := time.Now().Add(time.Second); ; {
+		events.Lock()
+		running := events.running
+		events.Unlock()
+		if !running || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	f := new_fake_cluster(1)
+	backend = f
+
+	sub := subscribe(&job_filter{}, 0)
+	defer unsubscribe(sub)
+
+	// the first poll is only the reference
+
+	time.Sleep(50 * time.Millisecond)
+
+	serve(context.Background(), "alice", "POST", "/job/submit", `{"Script":"#!/bin/sh\ntrue","Name":"a"}`)
+
+	next := func() *job_event {
+		select {
+		case e := <-sub.ch:
+			return e
+		case <-time.After(time.Second):
+			t.Fatal("no event")
+		}
+		return nil
+	}
+
+	e := next()
+
+	if e.Type != "created" || e.Name != "a" {
+		t.Fatalf("%+v, expected a created event", e)
+	}
+
+	f.Lock()
+	f.jobs = nil
+	f.job_update = time.Now().Unix()
+	f.Unlock()
+
+	purged := next()
+
+	if purged.Type != "purged" || purged.JobId != e.JobId || purged.Name != "a" || purged.UserId != 1000 {
+		t.Errorf("%+v, expected a purged event of job %d", purged, e.JobId)
+	}
+}
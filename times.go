@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// time_value is a time_t of a record, sent as a number of seconds
+// or formatted with RFC 3339 when asked for.
+
+type time_value int64
+
+func (t time_value) Format() interface{} {
+	if t == 0 {
+		return nil
+	}
+	return time.Unix(int64(t), 0).Format(time.RFC3339)
+}
+
+var time_units = map[string]time.Duration{
+	"":        time.Second,
+	"second":  time.Second,
+	"seconds": time.Second,
+	"minute":  time.Minute,
+	"minutes": time.Minute,
+	"hour":    time.Hour,
+	"hours":   time.Hour,
+	"day":     24 * time.Hour,
+	"days":    24 * time.Hour,
+	"week":    7 * 24 * time.Hour,
+	"weeks":   7 * 24 * time.Hour,
+}
+
+var time_relative = regexp.MustCompile(`^now(?:\s*([+-])\s*(\d+)\s*([a-z]*))?$`)
+
+var time_layouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// parse_time accepts a number of seconds, a date in RFC 3339 or
+// in the local time zone, and the relative forms of slurm:
+// now[{+|-}count[seconds|minutes|hours|days|weeks]], today, tomorrow.
+
+func parse_time(value json.RawMessage) (int64, error) {
+	var n int64
+
+	if json.Unmarshal(value, &n) == nil {
+		return n, nil
+	}
+
+	var s string
+
+	if err := json.Unmarshal(value, &s); err != nil {
+		return 0, err
+	}
+
+	s = strings.ToLower(strings.TrimSpace(s))
+	now := time.Now()
+
+	switch s {
+	case "today":
+		y, m, d := now.Date()
+		return time.Date(y, m, d, 0, 0, 0, 0, time.Local).Unix(), nil
+	case "tomorrow":
+		y, m, d := now.Date()
+		return time.Date(y, m, d+1, 0, 0, 0, 0, time.Local).Unix(), nil
+	}
+
+	if m := time_relative.FindStringSubmatch(s); m != nil {
+		if m[1] == "" {
+			return now.Unix(), nil
+		}
+		unit, ok := time_units[m[3]]
+		if !ok {
+			return 0, errors.New("Unknown time unit " + m[3])
+		}
+		count, err := strconv.ParseInt(m[2], 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		d := time.Duration(count) * unit
+		if m[1] == "-" {
+			d = -d
+		}
+		return now.Add(d).Unix(), nil
+	}
+
+	for _, layout := range time_layouts {
+		if t, err := time.ParseInLocation(layout, strings.ToUpper(s), time.Local); err == nil {
+			return t.Unix(), nil
+		}
+	}
+
+	return 0, errors.New("Bad time " + s)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// toml_value is a value of the config file with its line, for the errors.
+
+type toml_value struct {
+	value interface{}
+	line  int
+}
+
+// toml_split splits s on sep outside of the strings.
+
+func toml_split(s string, sep byte) []string {
+	var ret []string
+	var quote byte
+
+	start := 0
+
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == sep:
+			ret = append(ret, s[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(ret, s[start:])
+}
+
+// parse_toml_value parses a string, an integer, a float, a boolean
+// or an array of them.
+
+func parse_toml_value(s string) (interface{}, error) {
+	s = strings.TrimSpace(s)
+
+	switch {
+	case s == "":
+		return nil, errors.New("missing value")
+	case s == "true":
+		return true, nil
+	case s == "false":
+		return false, nil
+	case s[0] == '"':
+		return strconv.Unquote(s)
+	case s[0] == '\'':
+		if len(s) < 2 || s[len(s)-1] != '\'' || strings.Count(s, "'") != 2 {
+			return nil, errors.New("bad string: " + s)
+		}
+		return s[1 : len(s)-1], nil
+	case s[0] == '[':
+		if s[len(s)-1] != ']' {
+			return nil, errors.New("bad array: " + s)
+		}
+		var ret []interface{}
+		for _, item := range toml_split(s[1:len(s)-1], ',') {
+			if strings.TrimSpace(item) == "" {
+				continue
+			}
+			v, err := parse_toml_value(item)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, v)
+		}
+		return ret, nil
+	}
+
+	num := strings.Replace(s, "_", "", -1)
+
+	if n, err := strconv.ParseInt(num, 0, 64); err == nil {
+		return n, nil
+	}
+
+	if f, err := strconv.ParseFloat(num, 64); err == nil {
+		return f, nil
+	}
+
+	return nil, errors.New("bad value: " + s)
+}
+
+// parse_toml reads the subset of TOML used by the config file:
+// [tables] of "key = value" lines, arrays may span several lines.
+// Keys are given with the name of their table, like "tls.cert".
+
+func parse_toml(path string) (map[string]toml_value, error) {
+	ret := make(map[string]toml_value)
+
+	file, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	table := ""
+
+	for line := 1; scanner.Scan(); line++ {
+		str := strings.TrimSpace(toml_split(scanner.Text(), '#')[0])
+
+		if str == "" {
+			continue
+		}
+
+		if str[0] == '[' {
+			if str[len(str)-1] != ']' {
+				return nil, fmt.Errorf("%s:%d: expected \"[table]\"", path, line)
+			}
+			table = strings.TrimSpace(str[1:len(str)-1]) + "."
+			continue
+		}
+
+		fields := toml_split(str, '=')
+
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("%s:%d: expected \"key = value\"", path, line)
+		}
+
+		key := table + strings.TrimSpace(fields[0])
+		value := strings.TrimSpace(str[len(fields[0])+1:])
+		start := line
+
+		for strings.HasPrefix(value, "[") && !strings.HasSuffix(value, "]") && scanner.Scan() {
+			line++
+			value += " " + strings.TrimSpace(toml_split(scanner.Text(), '#')[0])
+		}
+
+		if _, ok := ret[key]; ok {
+			return nil, fmt.Errorf("%s:%d: duplicate key %s", path, start, key)
+		}
+
+		v, err := parse_toml_value(value)
+
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, start, err)
+		}
+
+		ret[key] = toml_value{v, start}
+	}
+
+	return ret, scanner.Err()
+}
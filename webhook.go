@@ -0,0 +1,432 @@
+package main
+
+/*
+#include "slurm/slurm.h"
+#include "slurm/slurm_errno.h"
+*/
+import "C"
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+type webhook struct {
+	Url      string
+	Payload  json.RawMessage
+	Attempts int
+	Next     time.Time
+}
+
+const webhook_attempts = 10
+
+var webhooks = struct {
+	sync.Mutex
+	path   string
+	key    []byte
+	allow  []*net.IPNet
+	jobs   map[uint32][]string
+	queue  []*webhook
+	wake   chan struct{}
+	client *http.Client
+}{
+	jobs: make(map[uint32][]string),
+	wake: make(chan struct{}, 1),
+}
+
+// webhook_allowed is false for the addresses of loopback, link-local,
+// private, multicast and unspecified networks, unless -webhook-allow
+// has them, so that a job can't make the server call its neighbours.
+
+func webhook_allowed(ip net.IP) bool {
+	for _, n := range webhooks.allow {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return ip.IsGlobalUnicast() && !ip.IsPrivate()
+}
+
+// webhook_control checks the address really dialed, after the name
+// was resolved again, and so whatever the DNS answered at submit.
+
+func webhook_control(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+
+	if err != nil {
+		return err
+	}
+
+	if ip := net.ParseIP(host); ip == nil || !webhook_allowed(ip) {
+		return errors.New("Callback address not allowed: " + host)
+	}
+
+	return nil
+}
+
+func webhook_check(callback string) error {
+	if webhooks.key == nil {
+		return errors.New("Webhooks are disabled")
+	}
+
+	u, err := url.Parse(callback)
+
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("Bad callback URL")
+	}
+
+	ips, err := net.LookupIP(u.Hostname())
+
+	if err != nil {
+		return errors.New("Unknown callback host: " + u.Hostname())
+	}
+
+	for _, ip := range ips {
+		if !webhook_allowed(ip) {
+			return errors.New("Callback address not allowed: " + ip.String())
+		}
+	}
+
+	return nil
+}
+
+// webhook_init loads the key used to sign the payloads and the
+// state saved in path, webhooks are disabled without a key.
+// allow is a comma separated list of networks that callbacks
+// may reach even though they are private.
+
+func webhook_init(key_path, path, allow string) error {
+	if key_path == "" {
+		return nil
+	}
+
+	for _, s := range strings.Split(allow, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		if !strings.Contains(s, "/") {
+			if strings.Contains(s, ":") {
+				s += "/128"
+			} else {
+				s += "/32"
+			}
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return err
+		}
+		webhooks.allow = append(webhooks.allow, n)
+	}
+
+	dialer := &net.Dialer{Timeout: 10 * time.Second, Control: webhook_control}
+
+	// no proxy, it would be the address checked, and no redirect,
+	// it could lead anywhere
+
+	webhooks.client = &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: &http.Transport{DialContext: dialer.DialContext},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	key, err := ioutil.ReadFile(key_path)
+
+	if err != nil {
+		return err
+	}
+
+	webhooks.key = bytes.TrimSpace(key)
+	webhooks.path = path
+
+	if err := webhook_load(); err != nil {
+		return err
+	}
+
+	go webhook_watch()
+	go webhook_deliver()
+
+	return nil
+}
+
+func webhook_load() error {
+	data, err := ioutil.ReadFile(webhooks.path)
+
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil || len(data) == 0 {
+		return err
+	}
+
+	state := struct {
+		Jobs  map[uint32][]string
+		Queue []*webhook
+	}{}
+
+	if err := json.Unmarshal(data, &state); err != nil {
+		return errors.New(webhooks.path + ": " + err.Error())
+	}
+
+	if state.Jobs != nil {
+		webhooks.jobs = state.Jobs
+	}
+
+	webhooks.queue = state.Queue
+
+	return nil
+}
+
+// webhook_save must be called with the lock held
+
+func webhook_save() {
+	data, err := json.Marshal(struct {
+		Jobs  map[uint32][]string
+		Queue []*webhook
+	}{webhooks.jobs, webhooks.queue})
+
+	if err == nil {
+		tmp := webhooks.path + ".tmp"
+		err = ioutil.WriteFile(tmp, data, 0600)
+		if err == nil {
+			err = os.Rename(tmp, webhooks.path)
+		}
+	}
+
+	if err != nil {
+		log.Println("webhooks:", err)
+	}
+}
+
+func webhook_wake() {
+	select {
+	case webhooks.wake <- struct{}{}:
+	default:
+	}
+}
+
+func webhook_track(job_id uint32, callback string) {
+	webhooks.Lock()
+	webhooks.jobs[job_id] = append(webhooks.jobs[job_id], callback)
+	webhook_save()
+	webhooks.Unlock()
+
+	webhook_wake()
+}
+
+func webhook_finish(e *job_event) {
+	webhooks.Lock()
+	defer webhooks.Unlock()
+
+	urls, ok := webhooks.jobs[e.JobId]
+
+	if !ok {
+		return
+	}
+
+	payload, _ := json.Marshal(e)
+
+	for _, u := range urls {
+		webhooks.queue = append(webhooks.queue, &webhook{
+			Url:     u,
+			Payload: payload,
+			Next:    time.Now(),
+		})
+	}
+
+	delete(webhooks.jobs, e.JobId)
+	webhook_save()
+}
+
+// webhook_sweep looks for the end of the tracked jobs that was not
+// seen as an event, e.g. while the server was down.
+
+func webhook_sweep() {
+	webhooks.Lock()
+	ids := make([]uint32, 0, len(webhooks.jobs))
+	for id := range webhooks.jobs {
+		ids = append(ids, id)
+	}
+	webhooks.Unlock()
+
+	for _, id := range ids {
+		slres, errno := backend.LoadJob(C.uint32_t(id), C.SHOW_ALL)
+
+		if errno != 0 {
+			if errno == C.ESLURM_INVALID_JOB_ID {
+				webhook_finish(&job_event{
+					Type:  "purged",
+					Time:  time.Now().Unix(),
+					JobId: id,
+				})
+			}
+			continue
+		}
+
+		count := int(slres.record_count)
+		carray := *(*[]C.job_info_t)(unsafe.Pointer(&reflect.SliceHeader{
+			Data: uintptr(unsafe.Pointer(slres.job_array)),
+			Len:  count,
+			Cap:  count,
+		}))
+
+		finished := count > 0
+
+		for i := 0; i < count; i++ {
+			if !job_finished(carray[i].job_state) {
+				finished = false
+			}
+		}
+
+		if finished {
+			job := &carray[0]
+			webhook_finish(&job_event{
+				Type:      "finished",
+				Time:      time.Now().Unix(),
+				JobId:     id,
+				JobState:  uint32(job.job_state),
+				UserId:    uint32(job.user_id),
+				Partition: C.GoString(job.partition),
+				Name:      C.GoString(job.name),
+			})
+		}
+
+		backend.Free(slres)
+	}
+}
+
+// webhook_watch listens to the job events while some jobs are tracked
+
+func webhook_watch() {
+	var sub *job_subscriber
+	var ch chan *job_event
+
+	sweep := time.NewTicker(time.Minute)
+
+	for {
+		webhooks.Lock()
+		tracked := len(webhooks.jobs)
+		webhooks.Unlock()
+
+		if tracked == 0 && sub != nil {
+			unsubscribe(sub)
+			sub, ch = nil, nil
+		}
+
+		if tracked > 0 && sub == nil {
+			sub = subscribe(&job_filter{}, 0)
+			ch = sub.ch
+			webhook_sweep()
+		}
+
+		select {
+		case e, ok := <-ch:
+			if !ok {
+				sub, ch = nil, nil
+				continue
+			}
+			if e.Type == "finished" || e.Type == "purged" {
+				webhook_finish(e)
+			}
+		case <-sweep.C:
+			if tracked > 0 {
+				webhook_sweep()
+			}
+		case <-webhooks.wake:
+		}
+	}
+}
+
+func webhook_post(h *webhook) error {
+	mac := hmac.New(sha256.New, webhooks.key)
+	mac.Write(h.Payload)
+
+	req, err := http.NewRequest("POST", h.Url, bytes.NewReader(h.Payload))
+
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Slurm-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+
+	res, err := webhooks.client.Do(req)
+
+	if err != nil {
+		return err
+	}
+
+	res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return errors.New(h.Url + ": " + strconv.Itoa(res.StatusCode))
+	}
+
+	return nil
+}
+
+// webhook_deliver posts the queued payloads, failed deliveries are
+// retried with an exponential backoff.
+
+func webhook_deliver() {
+	for {
+		webhooks.Lock()
+		now := time.Now()
+		due := make([]*webhook, 0)
+		for _, h := range webhooks.queue {
+			if !h.Next.After(now) {
+				due = append(due, h)
+			}
+		}
+		webhooks.Unlock()
+
+		for _, h := range due {
+			err := webhook_post(h)
+
+			webhooks.Lock()
+
+			if err != nil {
+				h.Attempts++
+				h.Next = time.Now().Add(time.Second << uint(h.Attempts))
+				log.Println("webhooks:", err)
+			}
+
+			if err != nil && h.Attempts >= webhook_attempts {
+				log.Println("webhooks: giving up on", h.Url)
+			}
+
+			if err == nil || h.Attempts >= webhook_attempts {
+				for i, v := range webhooks.queue {
+					if v == h {
+						webhooks.queue = append(webhooks.queue[:i], webhooks.queue[i+1:]...)
+						break
+					}
+				}
+			}
+
+			webhook_save()
+			webhooks.Unlock()
+		}
+
+		time.Sleep(time.Second)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// just enough of RFC 6455 to push text messages to a client
+
+const ws_guid = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+type websocket struct {
+	conn   net.Conn
+	rw     *bufio.ReadWriter
+	lock   sync.Mutex
+	closed chan struct{}
+}
+
+func ws_upgrade(w http.ResponseWriter, r *http.Request) (*websocket, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+
+	if key == "" || !strings.Contains(strings.ToLower(r.Header.Get("Connection")), "upgrade") {
+		return nil, errors.New("Bad websocket handshake")
+	}
+
+	hj, ok := w.(http.Hijacker)
+
+	if !ok {
+		return nil, errors.New("Websocket not supported")
+	}
+
+	conn, rw, err := hj.Hijack()
+
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha1.Sum([]byte(key + ws_guid))
+
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	rw.WriteString("Upgrade: websocket\r\n")
+	rw.WriteString("Connection: Upgrade\r\n")
+	rw.WriteString("Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n\r\n")
+
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	ws := &websocket{
+		conn:   conn,
+		rw:     rw,
+		closed: make(chan struct{}),
+	}
+
+	go ws.read()
+
+	return ws, nil
+}
+
+func (ws *websocket) write(opcode byte, data []byte) error {
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+
+	header := []byte{0x80 | opcode, 0}
+
+	switch n := len(data); {
+	case n < 126:
+		header[1] = byte(n)
+	case n < 65536:
+		header[1] = 126
+		header = append(header, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(n))
+	default:
+		header[1] = 127
+		header = append(header, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(header[2:], uint64(n))
+	}
+
+	ws.rw.Write(header)
+	ws.rw.Write(data)
+
+	return ws.rw.Flush()
+}
+
+func (ws *websocket) WriteText(data []byte) error {
+	return ws.write(0x1, data)
+}
+
+// read only answers pings and waits for the client to leave
+
+func (ws *websocket) read() {
+	defer close(ws.closed)
+
+	for {
+		var header [2]byte
+
+		if _, err := io.ReadFull(ws.rw, header[:]); err != nil {
+			return
+		}
+
+		opcode := header[0] & 0x0f
+		length := uint64(header[1] & 0x7f)
+
+		switch length {
+		case 126:
+			var ext [2]byte
+			if _, err := io.ReadFull(ws.rw, ext[:]); err != nil {
+				return
+			}
+			length = uint64(binary.BigEndian.Uint16(ext[:]))
+		case 127:
+			var ext [8]byte
+			if _, err := io.ReadFull(ws.rw, ext[:]); err != nil {
+				return
+			}
+			length = binary.BigEndian.Uint64(ext[:])
+		}
+
+		if length > 4096 {
+			return
+		}
+
+		var mask [4]byte
+
+		if header[1]&0x80 != 0 {
+			if _, err := io.ReadFull(ws.rw, mask[:]); err != nil {
+				return
+			}
+		}
+
+		data := make([]byte, length)
+
+		if _, err := io.ReadFull(ws.rw, data); err != nil {
+			return
+		}
+
+		for i := range data {
+			data[i] ^= mask[i%4]
+		}
+
+		switch opcode {
+		case 0x8:
+			ws.write(0x8, nil)
+			return
+		case 0x9:
+			ws.write(0xa, data)
+		}
+	}
+}
+
+func (ws *websocket) Close() error {
+	return ws.conn.Close()
+}